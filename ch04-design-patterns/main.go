@@ -1,7 +1,10 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"maps"
+	"sync"
 	"time"
 )
 
@@ -73,27 +76,68 @@ type UserRepository interface {
 	Save(user *User) error
 }
 
+// InMemoryUserRepository is safe for concurrent use
 type InMemoryUserRepository struct {
-	users  map[int]*User
-	nextID int
+	writeMu sync.Mutex // serializes Save and whole transactions
+	mu      sync.RWMutex
+	users   map[int]*User
+	nextID  int
+	parent  *InMemoryUserRepository // set on a transaction; users then holds only its writes
 }
 
 func NewInMemoryUserRepository() *InMemoryUserRepository {
 	return &InMemoryUserRepository{users: make(map[int]*User)}
 }
 
+// user looks up id, falling back to the parent of a transaction; r.mu must be held
+func (r *InMemoryUserRepository) user(id int) (*User, bool) {
+	if u, ok := r.users[id]; ok || r.parent == nil {
+		return u, ok
+	}
+	return r.parent.user(id)
+}
+
 func (r *InMemoryUserRepository) FindByID(id int) (*User, error) {
-	u, ok := r.users[id]
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	u, ok := r.user(id)
 	if !ok {
 		return nil, fmt.Errorf("user %d not found", id)
 	}
-	return u, nil
+	cp := *u // return a copy so callers can't mutate shared state
+	return &cp, nil
 }
 
 func (r *InMemoryUserRepository) Save(user *User) error {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	r.nextID++
 	user.ID = r.nextID
-	r.users[user.ID] = user
+	cp := *user
+	r.users[user.ID] = &cp
+	return nil
+}
+
+// Unit of Work pattern: WithTx runs fn against a transaction that keeps its
+// writes to itself and reads the rest from r. The writes are applied to r
+// when fn returns nil and dropped when it fails. Readers see the old state
+// until then; other writers wait.
+func (r *InMemoryUserRepository) WithTx(fn func(repo UserRepository) error) error {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+
+	// Holding writeMu keeps r unchanged, so tx can read it without r.mu
+	tx := &InMemoryUserRepository{users: make(map[int]*User), nextID: r.nextID, parent: r}
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	maps.Copy(r.users, tx.users)
+	r.nextID = tx.nextID
 	return nil
 }
 
@@ -114,4 +158,15 @@ func main() {
 	_ = repo.Save(user)
 	found, _ := repo.FindByID(user.ID)
 	fmt.Println("found user:", found.Name)
+
+	var bob User
+	err := repo.WithTx(func(tx UserRepository) error {
+		bob = User{Name: "Bob"}
+		if err := tx.Save(&bob); err != nil {
+			return err
+		}
+		return errors.New("changed my mind")
+	})
+	_, findErr := repo.FindByID(bob.ID)
+	fmt.Printf("rolled back: %v (%v)\n", err, findErr)
 }
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+// TestInMemoryUserRepositoryConcurrent is meant to be run with -race
+func TestInMemoryUserRepositoryConcurrent(t *testing.T) {
+	repo := NewInMemoryUserRepository()
+
+	const workers, iterations = 16, 100
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Go(func() {
+			for range iterations {
+				u := &User{Name: "Alice"}
+				if err := repo.Save(u); err != nil {
+					t.Error(err)
+					return
+				}
+				if _, err := repo.FindByID(u.ID); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		})
+	}
+	wg.Wait()
+
+	for id := 1; id <= workers*iterations; id++ {
+		if _, err := repo.FindByID(id); err != nil {
+			t.Errorf("FindByID(%d): %v", id, err)
+		}
+	}
+}
+
+func TestWithTx(t *testing.T) {
+	repo := NewInMemoryUserRepository()
+	alice := &User{Name: "Alice"}
+	if err := repo.Save(alice); err != nil {
+		t.Fatal(err)
+	}
+
+	var bob User
+	err := repo.WithTx(func(tx UserRepository) error {
+		bob = User{Name: "Bob"}
+		if err := tx.Save(&bob); err != nil {
+			return err
+		}
+		if _, err := tx.FindByID(alice.ID); err != nil {
+			t.Errorf("committed user not visible in transaction: %v", err)
+		}
+		if _, err := repo.FindByID(bob.ID); err == nil {
+			t.Error("uncommitted user visible outside the transaction")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := repo.FindByID(bob.ID); err != nil || got.Name != "Bob" {
+		t.Errorf("after commit: %+v, %v", got, err)
+	}
+
+	errAbort := errors.New("abort")
+	var carol User
+	err = repo.WithTx(func(tx UserRepository) error {
+		carol = User{Name: "Carol"}
+		if err := tx.Save(&carol); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("err = %v, want errAbort", err)
+	}
+	if _, err := repo.FindByID(carol.ID); err == nil {
+		t.Error("rolled back user is visible")
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+)
+
+// actorFrom names the caller recorded on writes: "user:N" for an
+// authenticated principal, empty otherwise
+func actorFrom(ctx context.Context) string {
+	if p, ok := principalFrom(ctx); ok {
+		return "user:" + strconv.Itoa(p.UserID)
+	}
+	return ""
+}
+
+// userHistoryResponse is the audit trail of one user, oldest first
+type userHistoryResponse struct {
+	Events []Event `json:"events"`
+}
+
+func userHistoryHandler(repo UserRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := pathID(r)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		events, err := repo.History(r.Context(), id)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, userHistoryResponse{Events: events})
+	}
+}
+
+func restoreUserHandler(repo UserRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := pathID(r)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		user, err := repo.Restore(r.Context(), id)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		w.Header().Set("ETag", userETag(user))
+		writeJSON(w, http.StatusOK, user)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestSoftDeleteAndRestore(t *testing.T) {
+	repos := map[string]func(t *testing.T) UserRepository{
+		"memory": func(t *testing.T) UserRepository { return NewInMemoryUserRepository() },
+		"sql":    func(t *testing.T) UserRepository { return newTestSQLRepository(t) },
+	}
+	for name, newRepo := range repos {
+		t.Run(name, func(t *testing.T) {
+			repo := newRepo(t)
+			ctx := withPrincipal(t.Context(), &Principal{UserID: 7})
+
+			alice := &User{Name: "Alice", Email: "alice@example.com"}
+			if err := repo.Save(ctx, alice); err != nil {
+				t.Fatal(err)
+			}
+			if alice.CreatedAt.IsZero() || alice.CreatedBy != "user:7" || !alice.UpdatedAt.Equal(alice.CreatedAt) {
+				t.Errorf("after Save: %+v", alice)
+			}
+			created := alice.CreatedAt
+
+			alice.Name = "Alice Smith"
+			if err := repo.Update(t.Context(), alice); err != nil {
+				t.Fatal(err)
+			}
+			if !alice.CreatedAt.Equal(created) || alice.CreatedBy != "user:7" || alice.UpdatedBy != "" || alice.UpdatedAt.Before(created) {
+				t.Errorf("after Update: %+v", alice)
+			}
+
+			if err := repo.Delete(ctx, alice.ID); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := repo.FindByID(t.Context(), alice.ID); !errors.Is(err, ErrNotFound) {
+				t.Errorf("FindByID deleted: err = %v, want ErrNotFound", err)
+			}
+			if err := repo.Delete(t.Context(), alice.ID); !errors.Is(err, ErrNotFound) {
+				t.Errorf("second Delete: err = %v, want ErrNotFound", err)
+			}
+			if page, _ := repo.List(t.Context(), ListOptions{}); len(page.Users) != 0 {
+				t.Errorf("List shows %d deleted users", len(page.Users))
+			}
+			page, err := repo.List(t.Context(), ListOptions{IncludeDeleted: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(page.Users) != 1 || page.Users[0].DeletedAt == nil || page.Users[0].DeletedBy != "user:7" {
+				t.Fatalf("List IncludeDeleted = %+v", page.Users)
+			}
+
+			// The email is free while Alice is deleted, so she cannot come back
+			imposter := &User{Name: "Imposter", Email: "ALICE@example.com"}
+			if err := repo.Save(t.Context(), imposter); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := repo.Restore(t.Context(), alice.ID); !errors.Is(err, ErrConflict) {
+				t.Errorf("Restore with taken email: err = %v, want ErrConflict", err)
+			}
+			if err := repo.Delete(t.Context(), imposter.ID); err != nil {
+				t.Fatal(err)
+			}
+			restored, err := repo.Restore(ctx, alice.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if restored.DeletedAt != nil || restored.Name != "Alice Smith" || restored.Version != 4 {
+				t.Errorf("restored = %+v", restored)
+			}
+			if _, err := repo.Restore(t.Context(), alice.ID); !errors.Is(err, ErrConflict) {
+				t.Errorf("Restore live user: err = %v, want ErrConflict", err)
+			}
+			if _, err := repo.Restore(t.Context(), 999); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Restore missing user: err = %v, want ErrNotFound", err)
+			}
+
+			history, err := repo.History(t.Context(), alice.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var types, actors []string
+			for _, e := range history {
+				types = append(types, string(e.Type))
+				actors = append(actors, e.Actor)
+			}
+			wantTypes := []string{"user.created", "user.updated", "user.deleted", "user.restored"}
+			if !slices.Equal(types, wantTypes) {
+				t.Errorf("history = %v, want %v", types, wantTypes)
+			}
+			if want := []string{"user:7", "", "user:7", "user:7"}; !slices.Equal(actors, want) {
+				t.Errorf("actors = %q, want %q", actors, want)
+			}
+			if _, err := repo.History(t.Context(), 999); !errors.Is(err, ErrNotFound) {
+				t.Errorf("History of missing user: err = %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestAuditEndpoints(t *testing.T) {
+	auth := newTestAuthenticator(t)
+	h := newServer(NewInMemoryUserRepository(), WithAuthenticator(auth))
+	admin := []string{"Authorization", bearer(t, auth, Principal{UserID: 1, Roles: []string{roleAdmin}})}
+
+	rec := doRequest(t, h, http.MethodPost, "/api/users", `{"name":"Alice","email":"alice@example.com"}`, admin...)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if u := decodeBody[User](t, rec); u.CreatedBy != "user:1" {
+		t.Errorf("created_by = %q", u.CreatedBy)
+	}
+	if rec := doRequest(t, h, http.MethodDelete, "/api/users/1", "", admin...); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete: status = %d", rec.Code)
+	}
+
+	rec = doRequest(t, h, http.MethodGet, "/api/users?include_deleted=true", "", admin...)
+	if list := decodeBody[userListResponse](t, rec); len(list.Users) != 1 || list.Users[0].DeletedAt == nil {
+		t.Errorf("include_deleted list = %s", rec.Body)
+	}
+
+	rec = doRequest(t, h, http.MethodPost, "/api/users/1/restore", "", admin...)
+	if rec.Code != http.StatusOK || rec.Header().Get("ETag") != `"3"` {
+		t.Fatalf("restore: status = %d, ETag = %s", rec.Code, rec.Header().Get("ETag"))
+	}
+
+	rec = doRequest(t, h, http.MethodGet, "/api/users/1/audit", "", admin...)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("audit: status = %d", rec.Code)
+	}
+	if got := decodeBody[userHistoryResponse](t, rec); len(got.Events) != 3 || got.Events[1].Actor != "user:1" {
+		t.Errorf("audit = %s", rec.Body)
+	}
+
+	// Only admins may read the audit trail, even their own
+	if rec := doRequest(t, h, http.MethodGet, "/api/users/1/audit", "", "Authorization", bearer(t, auth, Principal{UserID: 1})); rec.Code != http.StatusForbidden {
+		t.Errorf("non-admin audit: status = %d, want 403", rec.Code)
+	}
+}
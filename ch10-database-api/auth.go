@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUnauthenticated = errors.New("unauthenticated")
+	ErrForbidden       = errors.New("forbidden")
+)
+
+const roleAdmin = "admin"
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	UserID int      `json:"sub"`
+	Roles  []string `json:"roles,omitempty"`
+}
+
+func (p *Principal) IsAdmin() bool {
+	return slices.Contains(p.Roles, roleAdmin)
+}
+
+// CanAccess reports whether p may read or modify the given user
+func (p *Principal) CanAccess(userID int) bool {
+	return p.IsAdmin() || p.UserID == userID
+}
+
+// Authenticator resolves the principal of a request. It returns (nil, nil)
+// for anonymous requests and an ErrUnauthenticated error for bad credentials.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+func withPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey, p)
+}
+
+// principalFrom returns the caller stored by the authenticate middleware
+func principalFrom(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey).(*Principal)
+	return p, ok && p != nil
+}
+
+// authenticate stores the request's principal in its context
+func authenticate(a Authenticator) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, err := a.Authenticate(r)
+			if err != nil {
+				unauthorized(w, r, err)
+				return
+			}
+			if p != nil {
+				r = r.WithContext(withPrincipal(r.Context(), p))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func unauthorized(w http.ResponseWriter, r *http.Request, err error) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="users"`)
+	writeError(w, r, err)
+}
+
+// authorizer applies per-route access rules; the zero value allows everything,
+// which is how newServer runs when no Authenticator is configured
+type authorizer struct {
+	enabled bool
+}
+
+// admin allows only callers holding the admin role
+func (az authorizer) admin(next http.Handler) http.Handler {
+	return az.check(next, func(p *Principal, _ *http.Request) bool {
+		return p.IsAdmin()
+	})
+}
+
+// selfOrAdmin allows the user named by the {id} path segment, or an admin
+func (az authorizer) selfOrAdmin(next http.Handler) http.Handler {
+	return az.check(next, func(p *Principal, r *http.Request) bool {
+		id, err := pathID(r)
+		return err == nil && p.CanAccess(id)
+	})
+}
+
+func (az authorizer) check(next http.Handler, allow func(*Principal, *http.Request) bool) http.Handler {
+	if !az.enabled {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := principalFrom(r.Context())
+		if !ok {
+			unauthorized(w, r, fmt.Errorf("bearer token required: %w", ErrUnauthenticated))
+			return
+		}
+		if !allow(p, r) {
+			writeError(w, r, fmt.Errorf("user %d may not %s %s: %w", p.UserID, r.Method, r.URL.Path, ErrForbidden))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// HMACTokenAuthenticator issues and verifies bearer tokens of the form
+// base64url(claims) "." base64url(HMAC-SHA256(claims))
+type HMACTokenAuthenticator struct {
+	secret []byte
+	now    func() time.Time
+}
+
+// tokenClaims is the signed token payload
+type tokenClaims struct {
+	Principal
+	ExpiresAt int64 `json:"exp"`
+}
+
+func NewHMACTokenAuthenticator(secret []byte) (*HMACTokenAuthenticator, error) {
+	if len(secret) < 32 {
+		return nil, errors.New("hmac secret must be at least 32 bytes")
+	}
+	return &HMACTokenAuthenticator{secret: secret, now: time.Now}, nil
+}
+
+// Issue returns a token for p that expires after ttl
+func (a *HMACTokenAuthenticator) Issue(p Principal, ttl time.Duration) (string, error) {
+	payload, err := json.Marshal(tokenClaims{Principal: p, ExpiresAt: a.now().Add(ttl).Unix()})
+	if err != nil {
+		return "", fmt.Errorf("issue token: %w", err)
+	}
+	claims := base64.RawURLEncoding.EncodeToString(payload)
+	return claims + "." + base64.RawURLEncoding.EncodeToString(a.sign(claims)), nil
+}
+
+func (a *HMACTokenAuthenticator) sign(claims string) []byte {
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(claims))
+	return mac.Sum(nil)
+}
+
+func (a *HMACTokenAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	h := r.Header.Get("Authorization")
+	if h == "" {
+		return nil, nil
+	}
+	scheme, token, ok := strings.Cut(h, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return nil, fmt.Errorf("unsupported authorization scheme: %w", ErrUnauthenticated)
+	}
+	claims, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, fmt.Errorf("malformed token: %w", ErrUnauthenticated)
+	}
+	gotSig, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(gotSig, a.sign(claims)) {
+		return nil, fmt.Errorf("invalid token signature: %w", ErrUnauthenticated)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(claims)
+	if err != nil {
+		return nil, fmt.Errorf("malformed token: %w", ErrUnauthenticated)
+	}
+	var c tokenClaims
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return nil, fmt.Errorf("malformed token: %w", ErrUnauthenticated)
+	}
+	if a.now().Unix() >= c.ExpiresAt {
+		return nil, fmt.Errorf("token expired: %w", ErrUnauthenticated)
+	}
+	return &c.Principal, nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestAuthenticator(t *testing.T) *HMACTokenAuthenticator {
+	t.Helper()
+	a, err := NewHMACTokenAuthenticator([]byte(strings.Repeat("s", 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+// bearer returns an Authorization header value for p
+func bearer(t *testing.T, a *HMACTokenAuthenticator, p Principal) string {
+	t.Helper()
+	token, err := a.Issue(p, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "Bearer " + token
+}
+
+func TestHMACTokenAuthenticator(t *testing.T) {
+	a := newTestAuthenticator(t)
+	token, err := a.Issue(Principal{UserID: 7, Roles: []string{roleAdmin}}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authenticate := func(header string) (*Principal, error) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if header != "" {
+			r.Header.Set("Authorization", header)
+		}
+		return a.Authenticate(r)
+	}
+
+	p, err := authenticate("Bearer " + token)
+	if err != nil || p.UserID != 7 || !p.IsAdmin() {
+		t.Fatalf("valid token: p = %+v, err = %v", p, err)
+	}
+	if p, err := authenticate(""); p != nil || err != nil {
+		t.Errorf("anonymous: p = %+v, err = %v", p, err)
+	}
+
+	claims, _, _ := strings.Cut(token, ".")
+	other, _ := NewHMACTokenAuthenticator([]byte(strings.Repeat("x", 32)))
+	forged, _ := other.Issue(Principal{UserID: 7, Roles: []string{roleAdmin}}, time.Minute)
+	for name, header := range map[string]string{
+		"tampered": "Bearer " + claims + "X." + strings.SplitN(token, ".", 2)[1],
+		"forged":   "Bearer " + forged,
+		"scheme":   "Basic " + token,
+		"no dot":   "Bearer " + claims,
+	} {
+		if _, err := authenticate(header); !errors.Is(err, ErrUnauthenticated) {
+			t.Errorf("%s: err = %v, want ErrUnauthenticated", name, err)
+		}
+	}
+
+	a.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	if _, err := authenticate("Bearer " + token); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("expired: err = %v, want ErrUnauthenticated", err)
+	}
+}
+
+func TestAuthorization(t *testing.T) {
+	a := newTestAuthenticator(t)
+	repo := NewInMemoryUserRepository()
+	for _, n := range []string{"alice", "bob"} {
+		if err := repo.Save(t.Context(), &User{Name: n, Email: n + "@example.com"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h := newServer(repo, WithAuthenticator(a))
+
+	alice := bearer(t, a, Principal{UserID: 1})
+	admin := bearer(t, a, Principal{UserID: 99, Roles: []string{roleAdmin}})
+
+	tests := []struct {
+		name, method, target, auth string
+		want                       int
+	}{
+		{"anonymous", http.MethodGet, "/api/users/1", "", http.StatusUnauthorized},
+		{"bad token", http.MethodGet, "/api/users/1", "Bearer nope.nope", http.StatusUnauthorized},
+		{"own record", http.MethodGet, "/api/users/1", alice, http.StatusOK},
+		{"other record", http.MethodGet, "/api/users/2", alice, http.StatusForbidden},
+		{"delete other", http.MethodDelete, "/api/users/2", alice, http.StatusForbidden},
+		{"list as user", http.MethodGet, "/api/users", alice, http.StatusForbidden},
+		{"admin reads other", http.MethodGet, "/api/users/2", admin, http.StatusOK},
+		{"admin lists", http.MethodGet, "/api/users", admin, http.StatusOK},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := doRequest(t, h, tc.method, tc.target, "", "Authorization", tc.auth)
+			if rec.Code != tc.want {
+				t.Errorf("status = %d, want %d; body = %s", rec.Code, tc.want, rec.Body)
+			}
+			if rec.Code == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 without WWW-Authenticate")
+			}
+		})
+	}
+
+	rec := doRequest(t, h, http.MethodPost, "/api/users", `{"name":"carol","email":"carol@example.com"}`, "Authorization", alice)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("create as user: status = %d, want 403", rec.Code)
+	}
+	rec = doRequest(t, h, http.MethodPost, "/api/users", `{"name":"carol","email":"carol@example.com"}`, "Authorization", admin)
+	if rec.Code != http.StatusCreated {
+		t.Errorf("create as admin: status = %d, want 201", rec.Code)
+	}
+}
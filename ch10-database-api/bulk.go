@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	ndjsonContentType = "application/x-ndjson"
+	csvContentType    = "text/csv"
+
+	maxImportErrors = 100 // row errors listed in an import result
+	maxImportLine   = 64 << 10
+	exportPageSize  = 500
+)
+
+// importResult summarizes a bulk import. Failed counts every rejected row;
+// Errors lists the first maxImportErrors of them.
+type importResult struct {
+	Imported int         `json:"imported"`
+	Failed   int         `json:"failed"`
+	Errors   []*rowError `json:"errors"`
+}
+
+// rowError explains why one row of an import was rejected
+type rowError struct {
+	Row    int           `json:"row"` // line number in the body, starting at 1
+	Status int           `json:"status"`
+	Detail string        `json:"detail"`
+	Errors []*FieldError `json:"errors,omitempty"`
+}
+
+// userReader returns the next row of an import body and its line number.
+// It returns io.EOF at the end, a 4xx *Problem for a malformed row, and any
+// other error when the body cannot be read further.
+type userReader func() (row int, u User, err error)
+
+func newNDJSONReader(body io.Reader) userReader {
+	sc := bufio.NewScanner(body)
+	sc.Buffer(nil, maxImportLine)
+	line := 0
+	return func() (int, User, error) {
+		for sc.Scan() {
+			line++
+			b := bytes.TrimSpace(sc.Bytes())
+			if len(b) == 0 {
+				continue
+			}
+			var u User
+			dec := json.NewDecoder(bytes.NewReader(b))
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(&u); err != nil {
+				return line, u, invalidJSON(err)
+			}
+			if dec.More() {
+				return line, u, newProblem(http.StatusBadRequest, "line must contain a single JSON value")
+			}
+			return line, u, nil
+		}
+		if errors.Is(sc.Err(), bufio.ErrTooLong) {
+			return line + 1, User{}, newProblem(http.StatusRequestEntityTooLarge, "line exceeds %d bytes", maxImportLine)
+		}
+		if err := sc.Err(); err != nil {
+			return line, User{}, err
+		}
+		return line, User{}, io.EOF
+	}
+}
+
+// csvReadOnlyColumns are written by the export and skipped on import, so an
+// export can be imported as is
+var csvReadOnlyColumns = map[string]bool{"id": true, "version": true}
+
+// newCSVReader reads a header row naming the name and email columns, in any
+// order, next to any of csvReadOnlyColumns
+func newCSVReader(body io.Reader) (userReader, error) {
+	cr := csv.NewReader(body)
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, newProblem(http.StatusBadRequest, "CSV header row is missing")
+	}
+	if _, ok := errors.AsType[*csv.ParseError](err); ok {
+		return nil, newProblem(http.StatusBadRequest, "invalid CSV header: %v", err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	cols := map[string]int{"name": -1, "email": -1}
+	for i, h := range header {
+		h = strings.ToLower(strings.TrimSpace(h))
+		if csvReadOnlyColumns[h] {
+			continue
+		}
+		if _, ok := cols[h]; !ok {
+			return nil, newProblem(http.StatusBadRequest, "unknown CSV column %q", h)
+		}
+		cols[h] = i
+	}
+	for name, i := range cols {
+		if i < 0 {
+			return nil, newProblem(http.StatusBadRequest, "CSV column %q is missing", name)
+		}
+	}
+
+	return func() (int, User, error) {
+		rec, err := cr.Read()
+		line, _ := cr.FieldPos(0)
+		if parseErr, ok := errors.AsType[*csv.ParseError](err); ok {
+			return parseErr.StartLine, User{}, newProblem(http.StatusBadRequest, "invalid CSV row: %v", parseErr.Err)
+		}
+		if err != nil {
+			return line, User{}, err
+		}
+		return line, User{Name: rec[cols["name"]], Email: rec[cols["email"]]}, nil
+	}, nil
+}
+
+// bulkPaths are the import and export endpoints, which stream for longer
+// than an ordinary request may take
+var bulkPaths = map[string]bool{"/api/users:import": true, "/api/users:export": true}
+
+// isBulkRequest reports whether r is bounded by the bulk timeout rather
+// than the request timeout
+func isBulkRequest(r *http.Request) bool {
+	return bulkPaths[r.URL.Path]
+}
+
+// importUsersHandler creates one user per row of an NDJSON or CSV body.
+// Rows are independent: invalid rows are reported and the rest imported.
+func importUsersHandler(repo UserRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var next userReader
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		switch mediaType {
+		case ndjsonContentType:
+			next = newNDJSONReader(r.Body)
+		case csvContentType:
+			var err error
+			if next, err = newCSVReader(r.Body); err != nil {
+				writeError(w, r, bodyTooLarge(err))
+				return
+			}
+		default:
+			writeError(w, r, newProblem(http.StatusUnsupportedMediaType,
+				"Content-Type must be %s or %s", ndjsonContentType, csvContentType))
+			return
+		}
+
+		res := importResult{Errors: []*rowError{}}
+		for {
+			row, user, err := next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err == nil {
+				if err = validate(&user); err == nil {
+					err = repo.Save(r.Context(), &user)
+				}
+			}
+			if err == nil {
+				res.Imported++
+				continue
+			}
+
+			p := problemFor(bodyTooLarge(err))
+			if p.Status >= http.StatusInternalServerError || p.Status == http.StatusRequestEntityTooLarge {
+				// The body cannot be read further; report how far we got
+				if p.Detail != "" {
+					p.Detail += fmt.Sprintf(" (%d rows were imported)", res.Imported)
+				}
+				writeError(w, r, errors.Join(p, err))
+				return
+			}
+			res.Failed++
+			if len(res.Errors) < maxImportErrors {
+				res.Errors = append(res.Errors, &rowError{Row: row, Status: p.Status, Detail: p.Detail, Errors: p.Errors})
+			}
+		}
+		writeJSON(w, http.StatusOK, res)
+	}
+}
+
+// bodyTooLarge turns an exceeded body limit into a 413 problem and returns
+// other errors unchanged
+func bodyTooLarge(err error) error {
+	if _, ok := errors.AsType[*http.MaxBytesError](err); ok {
+		return decodeProblem(err)
+	}
+	return err
+}
+
+// exportUsersHandler streams every user as NDJSON or CSV, one page of the
+// repository at a time, so memory use does not grow with the data set
+func exportUsersHandler(repo UserRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format := r.URL.Query().Get("format")
+		var (
+			contentType string
+			write       func(u *User) error
+			flush       func() error
+		)
+		switch format {
+		case "", "ndjson":
+			format, contentType = "ndjson", ndjsonContentType
+			enc := json.NewEncoder(w)
+			write = func(u *User) error { return enc.Encode(u) }
+			flush = func() error { return nil }
+		case "csv":
+			contentType = csvContentType + "; charset=utf-8"
+			cw := csv.NewWriter(w) // buffered: nothing is sent before the first flush
+			_ = cw.Write([]string{"id", "name", "email", "version"})
+			write = func(u *User) error {
+				return cw.Write([]string{strconv.Itoa(u.ID), u.Name, u.Email, strconv.Itoa(u.Version)})
+			}
+			flush = func() error {
+				cw.Flush()
+				return cw.Error()
+			}
+		default:
+			writeError(w, r, newProblem(http.StatusBadRequest, "format must be ndjson or csv"))
+			return
+		}
+
+		var after *Cursor
+		for started := false; ; started = true {
+			page, err := repo.List(r.Context(), ListOptions{After: after, Limit: exportPageSize})
+			if err != nil && !started {
+				writeError(w, r, err)
+				return
+			}
+			if !started {
+				w.Header().Set("Content-Type", contentType)
+				w.Header().Set("Content-Disposition", `attachment; filename="users.`+format+`"`)
+			}
+			if err == nil {
+				for _, u := range page.Users {
+					if err = write(u); err != nil {
+						break
+					}
+				}
+			}
+			if err == nil {
+				err = flush()
+			}
+			if err != nil {
+				// The status is already sent; cut the stream so the client sees it is incomplete
+				logger.Error("export failed",
+					slog.String("request_id", requestIDFrom(r.Context())),
+					slog.Any("err", err),
+				)
+				panic(http.ErrAbortHandler)
+			}
+			_ = http.NewResponseController(w).Flush()
+			if page.Next == nil {
+				return
+			}
+			after = page.Next
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestImportNDJSON(t *testing.T) {
+	repo := NewInMemoryUserRepository()
+	h := newServer(repo)
+	body := strings.Join([]string{
+		`{"name":"Alice","email":"alice@example.com"}`,
+		``,
+		`{"name":"Bob","email":"not-an-email"}`,
+		`{"name":"Carol","email":"carol@example.com","admin":true}`,
+		`{"name":"Dave",`,
+		`{"name":"Alice 2","email":"ALICE@example.com"}`,
+		`{"name":"Erin","email":"erin@example.com"}`,
+	}, "\n")
+
+	rec := doRequest(t, h, http.MethodPost, "/api/users:import", body, "Content-Type", ndjsonContentType)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	res := decodeBody[importResult](t, rec)
+	if res.Imported != 2 || res.Failed != 4 {
+		t.Errorf("imported %d, failed %d; want 2 and 4", res.Imported, res.Failed)
+	}
+	want := []struct{ row, status int }{
+		{3, http.StatusUnprocessableEntity},
+		{4, http.StatusBadRequest},
+		{5, http.StatusBadRequest},
+		{6, http.StatusConflict},
+	}
+	if len(res.Errors) != len(want) {
+		t.Fatalf("errors = %+v", res.Errors)
+	}
+	for i, w := range want {
+		if e := res.Errors[i]; e.Row != w.row || e.Status != w.status {
+			t.Errorf("error %d = row %d status %d, want row %d status %d", i, e.Row, e.Status, w.row, w.status)
+		}
+	}
+	if len(res.Errors[0].Errors) != 1 || res.Errors[0].Errors[0].Field != "email" {
+		t.Errorf("validation error fields = %+v", res.Errors[0].Errors)
+	}
+}
+
+func TestImportCSV(t *testing.T) {
+	h := newServer(NewInMemoryUserRepository())
+
+	body := "email,name\nalice@example.com,Alice\n\"bob@example.com\",\"Bob, Jr.\"\nbad,\nonly-one-field\n"
+	rec := doRequest(t, h, http.MethodPost, "/api/users:import", body, "Content-Type", "text/csv; charset=utf-8")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	res := decodeBody[importResult](t, rec)
+	if res.Imported != 2 || res.Failed != 2 {
+		t.Fatalf("result = %+v", res)
+	}
+	if res.Errors[0].Row != 4 || res.Errors[1].Row != 5 {
+		t.Errorf("error rows = %d, %d; want 4, 5", res.Errors[0].Row, res.Errors[1].Row)
+	}
+
+	for name, body := range map[string]string{
+		"unknown column": "name,email,role\n",
+		"missing column": "name\nAlice\n",
+		"empty":          "",
+	} {
+		rec := doRequest(t, h, http.MethodPost, "/api/users:import", body, "Content-Type", csvContentType)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", name, rec.Code)
+		}
+	}
+
+	if rec := doRequest(t, h, http.MethodPost, "/api/users:import", "{}", "Content-Type", "application/json"); rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("JSON body: status = %d, want 415", rec.Code)
+	}
+}
+
+func TestImportBodyLimit(t *testing.T) {
+	h := newServer(NewInMemoryUserRepository(), WithMaxImportBytes(200))
+	var b strings.Builder
+	for i := range 10 {
+		fmt.Fprintf(&b, `{"name":"user%d","email":"user%d@example.com"}`+"\n", i, i)
+	}
+	rec := doRequest(t, h, http.MethodPost, "/api/users:import", b.String(), "Content-Type", ndjsonContentType)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want 413", rec.Code)
+	}
+	if p := decodeBody[Problem](t, rec); !strings.Contains(p.Detail, "rows were imported") {
+		t.Errorf("detail = %q", p.Detail)
+	}
+}
+
+func TestExport(t *testing.T) {
+	repo := NewInMemoryUserRepository()
+	n := exportPageSize + 3 // more than one page
+	for i := range n {
+		if err := repo.Save(t.Context(), &User{Name: fmt.Sprintf("user%d", i), Email: fmt.Sprintf("user%d@example.com", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h := newServer(repo, WithCompression(false))
+
+	rec := doRequest(t, h, http.MethodGet, "/api/users:export", "")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != ndjsonContentType {
+		t.Fatalf("ndjson: status = %d, Content-Type = %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	sc := bufio.NewScanner(rec.Body)
+	lines := 0
+	for ; sc.Scan(); lines++ {
+		var u User
+		if err := json.Unmarshal(sc.Bytes(), &u); err != nil {
+			t.Fatal(err)
+		}
+		if u.ID != lines+1 {
+			t.Fatalf("line %d has user %d", lines+1, u.ID)
+		}
+	}
+	if lines != n {
+		t.Errorf("ndjson: %d lines, want %d", lines, n)
+	}
+
+	rec = doRequest(t, h, http.MethodGet, "/api/users:export?format=csv", "")
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), csvContentType) {
+		t.Fatalf("csv: status = %d, Content-Type = %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	records, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != n+1 || strings.Join(records[0], ",") != "id,name,email,version" {
+		t.Errorf("csv: %d records, header %v", len(records), records[0])
+	}
+	if got := strings.Join(records[1], ","); got != "1,user0,user0@example.com,1" {
+		t.Errorf("csv first row = %q", got)
+	}
+
+	if rec := doRequest(t, h, http.MethodGet, "/api/users:export?format=xml", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("xml: status = %d, want 400", rec.Code)
+	}
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	for _, format := range []string{"ndjson", "csv"} {
+		t.Run(format, func(t *testing.T) {
+			src := NewInMemoryUserRepository()
+			for _, name := range []string{"Alice", "Bob, Jr."} {
+				if err := src.Save(t.Context(), &User{Name: name, Email: strings.ToLower(name[:3]) + "@example.com"}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			exported := doRequest(t, newServer(src), http.MethodGet, "/api/users:export?format="+format, "")
+			if exported.Code != http.StatusOK {
+				t.Fatalf("export: status = %d, body = %s", exported.Code, exported.Body)
+			}
+
+			dst := NewInMemoryUserRepository()
+			rec := doRequest(t, newServer(dst), http.MethodPost, "/api/users:import", exported.Body.String(),
+				"Content-Type", exported.Header().Get("Content-Type"))
+			if res := decodeBody[importResult](t, rec); rec.Code != http.StatusOK || res.Imported != 2 || res.Failed != 0 {
+				t.Fatalf("import: status = %d, body = %s", rec.Code, rec.Body)
+			}
+			for id, want := range map[int]string{1: "Alice", 2: "Bob, Jr."} {
+				if u, err := dst.FindByID(t.Context(), id); err != nil || u.Name != want {
+					t.Errorf("user %d = %+v, %v; want %s", id, u, err, want)
+				}
+			}
+		})
+	}
+}
+
+// slowRepository makes every Save and List take at least delay
+type slowRepository struct {
+	UserRepository
+	delay time.Duration
+}
+
+func (r *slowRepository) wait(ctx context.Context) error {
+	select {
+	case <-time.After(r.delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *slowRepository) Save(ctx context.Context, u *User) error {
+	if err := r.wait(ctx); err != nil {
+		return err
+	}
+	return r.UserRepository.Save(ctx, u)
+}
+
+func (r *slowRepository) List(ctx context.Context, opts ListOptions) (*UserPage, error) {
+	if err := r.wait(ctx); err != nil {
+		return nil, err
+	}
+	return r.UserRepository.List(ctx, opts)
+}
+
+func TestBulkOutlivesRequestTimeout(t *testing.T) {
+	repo := &slowRepository{UserRepository: NewInMemoryUserRepository(), delay: 20 * time.Millisecond}
+	h := newServer(repo, WithRequestTimeout(10*time.Millisecond))
+
+	body := "name,email\nAlice,alice@example.com\nBob,bob@example.com\nCarol,carol@example.com\n"
+	rec := doRequest(t, h, http.MethodPost, "/api/users:import", body, "Content-Type", csvContentType)
+	if res := decodeBody[importResult](t, rec); rec.Code != http.StatusOK || res.Imported != 3 {
+		t.Fatalf("import: status = %d, body = %s", rec.Code, rec.Body)
+	}
+	rec = doRequest(t, h, http.MethodGet, "/api/users:export?format=csv", "")
+	if rec.Code != http.StatusOK || strings.Count(rec.Body.String(), "\n") != 4 {
+		t.Errorf("export: status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	// Ordinary routes still get the request timeout
+	if rec := doRequest(t, h, http.MethodGet, "/api/users", ""); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("list: status = %d, want 503", rec.Code)
+	}
+
+	// The bulk timeout bounds bulk routes instead
+	h = newServer(repo, WithBulkTimeout(10*time.Millisecond))
+	if rec := doRequest(t, h, http.MethodGet, "/api/users:export", ""); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("export past bulk timeout: status = %d, want 503", rec.Code)
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"expvar"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CacheStats are cumulative counters of a CachingUserRepository
+type CacheStats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+	Size      int    `json:"size"`
+}
+
+// CachingUserRepository is a read-through cache for FindByID in front of
+// another repository. Entries expire after ttl and the least recently used
+// is evicted beyond size. Writes invalidate the affected user, and
+// concurrent misses for the same ID share a single lookup.
+type CachingUserRepository struct {
+	next UserRepository
+	ttl  time.Duration
+	size int
+	now  func() time.Time
+
+	mu       sync.Mutex
+	entries  map[int]*list.Element // values are *cacheEntry
+	lru      *list.List            // front is most recently used
+	inflight map[int]*cacheCall
+
+	hits, misses, evictions atomic.Uint64
+}
+
+type cacheEntry struct {
+	user    *User
+	expires time.Time
+}
+
+// cacheCall is a lookup in progress that other readers wait on
+type cacheCall struct {
+	done chan struct{}
+	user *User
+	err  error
+}
+
+func NewCachingUserRepository(next UserRepository, size int, ttl time.Duration) *CachingUserRepository {
+	return &CachingUserRepository{
+		next:     next,
+		ttl:      ttl,
+		size:     size,
+		now:      time.Now,
+		entries:  make(map[int]*list.Element),
+		lru:      list.New(),
+		inflight: make(map[int]*cacheCall),
+	}
+}
+
+// publishedCache is the cache reported by the user_cache expvar
+var publishedCache atomic.Pointer[CachingUserRepository]
+
+func init() {
+	expvar.Publish("user_cache", expvar.Func(func() any {
+		if c := publishedCache.Load(); c != nil {
+			return c.Stats()
+		}
+		return nil
+	}))
+}
+
+// Publish reports c's Stats as the user_cache variable at GET /debug/vars,
+// replacing any cache published before
+func (c *CachingUserRepository) Publish() {
+	publishedCache.Store(c)
+}
+
+// Stats returns the counters
+func (c *CachingUserRepository) Stats() CacheStats {
+	c.mu.Lock()
+	size := c.lru.Len()
+	c.mu.Unlock()
+	return CacheStats{
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Evictions: c.evictions.Load(),
+		Size:      size,
+	}
+}
+
+func (c *CachingUserRepository) FindByID(ctx context.Context, id int) (*User, error) {
+	for retry := false; ; retry = true {
+		c.mu.Lock()
+		if u, ok := c.get(id); ok {
+			c.mu.Unlock()
+			c.hits.Add(1)
+			return u, nil
+		}
+		if !retry {
+			c.misses.Add(1)
+		}
+		call, waiting := c.inflight[id]
+		if !waiting {
+			call = &cacheCall{done: make(chan struct{})}
+			c.inflight[id] = call
+		}
+		c.mu.Unlock()
+
+		if !waiting {
+			return c.load(ctx, id, call)
+		}
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		// The leader's own cancellation says nothing about ours; try again
+		if isContextErr(call.err) && ctx.Err() == nil {
+			continue
+		}
+		if call.err != nil {
+			return nil, call.err
+		}
+		cp := *call.user
+		return &cp, nil
+	}
+}
+
+// load fetches id from the underlying repository on behalf of all waiters
+func (c *CachingUserRepository) load(ctx context.Context, id int, call *cacheCall) (*User, error) {
+	defer close(call.done)
+	call.user, call.err = c.next.FindByID(ctx, id)
+
+	c.mu.Lock()
+	// A write invalidated id while we were loading; the result may be stale
+	if c.inflight[id] == call {
+		delete(c.inflight, id)
+		if call.err == nil {
+			c.put(id, call.user)
+		}
+	}
+	c.mu.Unlock()
+
+	if call.err != nil {
+		return nil, call.err
+	}
+	cp := *call.user
+	return &cp, nil
+}
+
+// get returns a copy of a fresh entry; c.mu must be held
+func (c *CachingUserRepository) get(id int) (*User, bool) {
+	el, ok := c.entries[id]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*cacheEntry)
+	if !c.now().Before(e.expires) {
+		c.lru.Remove(el)
+		delete(c.entries, id)
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	cp := *e.user
+	return &cp, true
+}
+
+// put stores a copy of u, evicting the least recently used entries; c.mu must be held
+func (c *CachingUserRepository) put(id int, u *User) {
+	cp := *u
+	e := &cacheEntry{user: &cp, expires: c.now().Add(c.ttl)}
+	if el, ok := c.entries[id]; ok {
+		el.Value = e
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.entries[id] = c.lru.PushFront(e)
+	for c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).user.ID)
+		c.evictions.Add(1)
+	}
+}
+
+// Invalidate drops id from the cache and detaches any lookup in flight
+func (c *CachingUserRepository) Invalidate(id int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[id]; ok {
+		c.lru.Remove(el)
+		delete(c.entries, id)
+	}
+	delete(c.inflight, id)
+}
+
+// Save invalidates too: a lookup of the new ID may have raced the insert
+func (c *CachingUserRepository) Save(ctx context.Context, user *User) error {
+	err := c.next.Save(ctx, user)
+	if err == nil {
+		c.Invalidate(user.ID)
+	}
+	return err
+}
+
+// Update invalidates even on failure, since a version mismatch means the
+// cached copy may be stale
+func (c *CachingUserRepository) Update(ctx context.Context, user *User) error {
+	defer c.Invalidate(user.ID)
+	return c.next.Update(ctx, user)
+}
+
+func (c *CachingUserRepository) Delete(ctx context.Context, id int) error {
+	defer c.Invalidate(id)
+	return c.next.Delete(ctx, id)
+}
+
+func (c *CachingUserRepository) Restore(ctx context.Context, id int) (*User, error) {
+	defer c.Invalidate(id)
+	return c.next.Restore(ctx, id)
+}
+
+func (c *CachingUserRepository) History(ctx context.Context, id int) ([]Event, error) {
+	return c.next.History(ctx, id)
+}
+
+// List is not cached; filtered pages are rarely repeated
+func (c *CachingUserRepository) List(ctx context.Context, opts ListOptions) (*UserPage, error) {
+	return c.next.List(ctx, opts)
+}
+
+// WithTx runs fn in a transaction of the underlying repository, bypassing
+// the cache, and invalidates every user written once it completes
+func (c *CachingUserRepository) WithTx(ctx context.Context, fn func(repo UserRepository) error) error {
+	var touched []int
+	defer func() {
+		for _, id := range touched {
+			c.Invalidate(id)
+		}
+	}()
+	return withTx(ctx, c.next, func(repo UserRepository) error {
+		return fn(&writeTracker{UserRepository: repo, touched: &touched})
+	})
+}
+
+// writeTracker reports the IDs written through it
+type writeTracker struct {
+	UserRepository
+	touched *[]int
+}
+
+func (t *writeTracker) Save(ctx context.Context, user *User) error {
+	err := t.UserRepository.Save(ctx, user)
+	if err == nil {
+		*t.touched = append(*t.touched, user.ID)
+	}
+	return err
+}
+
+func (t *writeTracker) Update(ctx context.Context, user *User) error {
+	*t.touched = append(*t.touched, user.ID)
+	return t.UserRepository.Update(ctx, user)
+}
+
+func (t *writeTracker) Delete(ctx context.Context, id int) error {
+	*t.touched = append(*t.touched, id)
+	return t.UserRepository.Delete(ctx, id)
+}
+
+func (t *writeTracker) Restore(ctx context.Context, id int) (*User, error) {
+	*t.touched = append(*t.touched, id)
+	return t.UserRepository.Restore(ctx, id)
+}
+
+func isContextErr(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
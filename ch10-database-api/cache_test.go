@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingRepo counts FindByID calls and can hold them until release is closed
+type countingRepo struct {
+	UserRepository
+	finds   atomic.Int64
+	release chan struct{}
+}
+
+func (r *countingRepo) FindByID(ctx context.Context, id int) (*User, error) {
+	r.finds.Add(1)
+	if r.release != nil {
+		<-r.release
+	}
+	return r.UserRepository.FindByID(ctx, id)
+}
+
+func newTestCache(t *testing.T, size int) (*CachingUserRepository, *countingRepo, *User) {
+	t.Helper()
+	inner := &countingRepo{UserRepository: NewInMemoryUserRepository()}
+	u := &User{Name: "Alice", Email: "alice@example.com"}
+	if err := inner.Save(t.Context(), u); err != nil {
+		t.Fatal(err)
+	}
+	return NewCachingUserRepository(inner, size, time.Minute), inner, u
+}
+
+func TestCacheHitsAndTTL(t *testing.T) {
+	c, inner, u := newTestCache(t, 10)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	for range 3 {
+		got, err := c.FindByID(t.Context(), u.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got.Name = "mutated" // callers get copies
+	}
+	if n := inner.finds.Load(); n != 1 {
+		t.Errorf("underlying finds = %d, want 1", n)
+	}
+	if s := c.Stats(); s.Hits != 2 || s.Misses != 1 {
+		t.Errorf("stats = %+v, want 2 hits and 1 miss", s)
+	}
+	if got, _ := c.FindByID(t.Context(), u.ID); got.Name != "Alice" {
+		t.Errorf("cached name = %q, want Alice", got.Name)
+	}
+
+	now = now.Add(time.Minute)
+	if _, err := c.FindByID(t.Context(), u.ID); err != nil {
+		t.Fatal(err)
+	}
+	if n := inner.finds.Load(); n != 2 {
+		t.Errorf("underlying finds after expiry = %d, want 2", n)
+	}
+}
+
+func TestCacheLRUEviction(t *testing.T) {
+	c, _, alice := newTestCache(t, 2)
+	bob := &User{Name: "Bob", Email: "bob@example.com"}
+	carol := &User{Name: "Carol", Email: "carol@example.com"}
+	for _, u := range []*User{bob, carol} {
+		if err := c.Save(t.Context(), u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c.FindByID(t.Context(), alice.ID)
+	c.FindByID(t.Context(), bob.ID)
+	c.FindByID(t.Context(), alice.ID) // alice is now more recent than bob
+	c.FindByID(t.Context(), carol.ID) // evicts bob
+
+	s := c.Stats()
+	if s.Evictions != 1 || s.Size != 2 {
+		t.Fatalf("stats = %+v, want 1 eviction and size 2", s)
+	}
+	c.FindByID(t.Context(), alice.ID)
+	if got := c.Stats().Hits; got != s.Hits+1 {
+		t.Errorf("alice was evicted")
+	}
+	c.FindByID(t.Context(), bob.ID)
+	if got := c.Stats().Misses; got != s.Misses+1 {
+		t.Errorf("bob was not evicted")
+	}
+}
+
+func TestCacheInvalidatesOnWrite(t *testing.T) {
+	c, _, u := newTestCache(t, 10)
+	cached, _ := c.FindByID(t.Context(), u.ID)
+
+	cached.Name = "Alice Smith"
+	if err := c.Update(t.Context(), cached); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := c.FindByID(t.Context(), u.ID); got.Name != "Alice Smith" {
+		t.Errorf("after Update got %q", got.Name)
+	}
+
+	// Writes inside a transaction invalidate once it commits
+	err := c.WithTx(t.Context(), func(repo UserRepository) error {
+		cur, err := repo.FindByID(t.Context(), u.ID)
+		if err != nil {
+			return err
+		}
+		cur.Name = "Alice Jones"
+		return repo.Update(t.Context(), cur)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := c.FindByID(t.Context(), u.ID); got.Name != "Alice Jones" {
+		t.Errorf("after WithTx got %q", got.Name)
+	}
+
+	if err := c.Delete(t.Context(), u.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.FindByID(t.Context(), u.ID); err == nil {
+		t.Error("FindByID after Delete succeeded")
+	}
+}
+
+func TestCacheCoalescesMisses(t *testing.T) {
+	c, inner, u := newTestCache(t, 10)
+	inner.release = make(chan struct{})
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Go(func() {
+			if _, err := c.FindByID(t.Context(), u.ID); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	// Let every reader reach the cache before the lookup completes
+	for c.Stats().Misses < 10 {
+		time.Sleep(time.Millisecond)
+	}
+	close(inner.release)
+	wg.Wait()
+
+	if n := inner.finds.Load(); n != 1 {
+		t.Errorf("underlying finds = %d, want 1", n)
+	}
+}
+
+func TestCacheStatsAreServed(t *testing.T) {
+	cache := NewCachingUserRepository(NewInMemoryUserRepository(), 10, time.Minute)
+	cache.Publish()
+	t.Cleanup(func() { publishedCache.Store(nil) })
+	if _, err := cache.FindByID(t.Context(), 1); !errors.Is(err, ErrNotFound) {
+		t.Fatal(err)
+	}
+
+	auth := newTestAuthenticator(t)
+	h := newServer(cache, WithAuthenticator(auth))
+	rec := doRequest(t, h, http.MethodGet, "/debug/vars", "",
+		"Authorization", bearer(t, auth, Principal{UserID: 1, Roles: []string{roleAdmin}}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	vars := decodeBody[struct {
+		UserCache CacheStats `json:"user_cache"`
+	}](t, rec)
+	if vars.UserCache != (CacheStats{Misses: 1}) {
+		t.Errorf("user_cache = %+v", vars.UserCache)
+	}
+
+	if rec := doRequest(t, h, http.MethodGet, "/debug/vars", "", "Authorization", bearer(t, auth, Principal{UserID: 2})); rec.Code != http.StatusForbidden {
+		t.Errorf("non-admin: status = %d, want 403", rec.Code)
+	}
+}
@@ -0,0 +1,356 @@
+// Package client is a typed Go client for the users API.
+//
+// Failed calls return an *Error that matches sentinel errors such as
+// ErrNotFound with errors.Is. Reads and CreateUser are retried with
+// exponential backoff on network errors, 429 and 502-504, within the
+// context deadline; other writes are not.
+package client
+
+import (
+	"bytes"
+	"context"
+	crand "crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// User mirrors the server's user resource
+type User struct {
+	ID        int        `json:"id"`
+	Name      string     `json:"name"`
+	Email     string     `json:"email"`
+	Version   int        `json:"version"`
+	CreatedAt time.Time  `json:"created_at"`
+	CreatedBy string     `json:"created_by,omitempty"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	UpdatedBy string     `json:"updated_by,omitempty"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	DeletedBy string     `json:"deleted_by,omitempty"`
+}
+
+// NewUser is the body of CreateUser
+type NewUser struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// UserPatch changes the non-nil fields of a user
+type UserPatch struct {
+	Name  *string `json:"name,omitempty"`
+	Email *string `json:"email,omitempty"`
+}
+
+// ListOptions filters and pages ListUsers; zero values use server defaults
+type ListOptions struct {
+	Name           string
+	Email          string
+	Sort           string // id, name or email; prefix with - to sort descending
+	Cursor         string // NextCursor of the previous page
+	Limit          int
+	IncludeDeleted bool
+}
+
+// UserPage is one page of ListUsers
+type UserPage struct {
+	Users      []User `json:"users"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Client calls the users API. It is safe for concurrent use.
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	token      string
+	retries    int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+}
+
+// Option configures New
+type Option func(*Client)
+
+// WithHTTPClient replaces http.DefaultClient
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = hc
+	}
+}
+
+// WithToken sends token as a bearer token on every request
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithRetry sets how often a failed request is retried and the bounds of
+// the exponential backoff between attempts; 0 retries disables retrying
+func WithRetry(retries int, minBackoff, maxBackoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries, c.minBackoff, c.maxBackoff = retries, minBackoff, maxBackoff
+	}
+}
+
+// New returns a client for the API at baseURL, e.g. "http://localhost:8080"
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("client: base URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("client: base URL %q must be http or https", baseURL)
+	}
+	c := &Client{
+		baseURL:    u,
+		httpClient: http.DefaultClient,
+		retries:    3,
+		minBackoff: 100 * time.Millisecond,
+		maxBackoff: 2 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// GetUser returns a live user; deleted users are ErrNotFound
+func (c *Client) GetUser(ctx context.Context, id int) (*User, error) {
+	var u User
+	if err := c.do(ctx, &request{method: http.MethodGet, path: userPath(id)}, &u); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// CreateUser sends a fresh Idempotency-Key, so retries cannot create duplicates
+func (c *Client) CreateUser(ctx context.Context, nu NewUser) (*User, error) {
+	var u User
+	req := &request{
+		method: http.MethodPost, path: "/api/users", body: nu,
+		header: http.Header{"Idempotency-Key": {crand.Text()}},
+	}
+	if err := c.do(ctx, req, &u); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// ListUsers returns one page of users
+func (c *Client) ListUsers(ctx context.Context, opts ListOptions) (*UserPage, error) {
+	q := url.Values{}
+	for k, v := range map[string]string{"name": opts.Name, "email": opts.Email, "sort": opts.Sort, "cursor": opts.Cursor} {
+		if v != "" {
+			q.Set(k, v)
+		}
+	}
+	if opts.Limit > 0 {
+		q.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	if opts.IncludeDeleted {
+		q.Set("include_deleted", "true")
+	}
+	var page UserPage
+	if err := c.do(ctx, &request{method: http.MethodGet, path: "/api/users", query: q}, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// UpdateUser replaces the name and email of u. It fails with
+// ErrVersionMismatch if the user changed since u was read. Failed updates
+// are not retried, since a repeat could not tell its own change from another.
+func (c *Client) UpdateUser(ctx context.Context, u *User) (*User, error) {
+	var out User
+	req := &request{
+		method: http.MethodPut, path: userPath(u.ID), body: NewUser{Name: u.Name, Email: u.Email},
+		header: ifMatch(u.Version),
+	}
+	if err := c.do(ctx, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PatchUser changes some fields of the user at version
+func (c *Client) PatchUser(ctx context.Context, id, version int, patch UserPatch) (*User, error) {
+	var out User
+	req := &request{method: http.MethodPatch, path: userPath(id), body: patch, header: ifMatch(version)}
+	if err := c.do(ctx, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteUser soft-deletes a user; version 0 deletes whatever the current
+// version is. Like UpdateUser it is not retried.
+func (c *Client) DeleteUser(ctx context.Context, id, version int) error {
+	req := &request{method: http.MethodDelete, path: userPath(id)}
+	if version > 0 {
+		req.header = ifMatch(version)
+	}
+	return c.do(ctx, req, nil)
+}
+
+// RestoreUser undoes DeleteUser; ErrConflict if its email was taken meanwhile
+func (c *Client) RestoreUser(ctx context.Context, id int) (*User, error) {
+	var u User
+	if err := c.do(ctx, &request{method: http.MethodPost, path: userPath(id) + "/restore"}, &u); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+func userPath(id int) string {
+	return "/api/users/" + strconv.Itoa(id)
+}
+
+func ifMatch(version int) http.Header {
+	return http.Header{"If-Match": {strconv.Quote(strconv.Itoa(version))}}
+}
+
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	header http.Header
+	body   any
+}
+
+// retryable reports whether repeating req cannot apply its effect twice
+// or turn its success into an error
+func (r *request) retryable() bool {
+	switch r.method {
+	case http.MethodGet:
+		return true
+	case http.MethodPost:
+		return r.header.Get("Idempotency-Key") != ""
+	}
+	// PUT and PATCH carry If-Match and DELETE removes the user, so a repeat
+	// after a lost success fails with 412 or 404 instead of applying twice;
+	// callers get to decide what that means
+	return false
+}
+
+// do sends req, retrying when allowed, and decodes a success body into out
+func (c *Client) do(ctx context.Context, req *request, out any) error {
+	var body []byte
+	if req.body != nil {
+		var err error
+		if body, err = json.Marshal(req.body); err != nil {
+			return fmt.Errorf("client: encode %s %s: %w", req.method, req.path, err)
+		}
+	}
+	for attempt := 0; ; attempt++ {
+		resp, err := c.send(ctx, req, body)
+		if err == nil && resp.StatusCode < 300 {
+			defer resp.Body.Close()
+			if out == nil || resp.StatusCode == http.StatusNoContent {
+				return nil
+			}
+			if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+				return fmt.Errorf("client: decode %s %s: %w", req.method, req.path, err)
+			}
+			return nil
+		}
+
+		var retryAfter time.Duration
+		if err == nil {
+			retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+			err = readError(resp)
+		} else if ctx.Err() != nil {
+			return err // our own deadline or cancellation, not a transient failure
+		}
+		if attempt >= c.retries || !req.retryable() || !transient(err) {
+			return err
+		}
+		if sleepErr := c.sleep(ctx, attempt, retryAfter); sleepErr != nil {
+			return errors.Join(sleepErr, err)
+		}
+	}
+}
+
+func (c *Client) send(ctx context.Context, req *request, body []byte) (*http.Response, error) {
+	u := c.baseURL.JoinPath(req.path)
+	u.RawQuery = req.query.Encode()
+	var r io.Reader = http.NoBody
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	hreq, err := http.NewRequestWithContext(ctx, req.method, u.String(), r)
+	if err != nil {
+		return nil, fmt.Errorf("client: %w", err)
+	}
+	for k, vs := range req.header {
+		hreq.Header[k] = vs
+	}
+	hreq.Header.Set("Accept", "application/json")
+	if body != nil {
+		hreq.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		hreq.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.httpClient.Do(hreq)
+	if err != nil {
+		return nil, fmt.Errorf("client: %s %s: %w", req.method, req.path, err)
+	}
+	return resp, nil
+}
+
+// readError turns a failed response into an *Error and closes its body
+func readError(resp *http.Response) error {
+	defer resp.Body.Close()
+	e := &Error{Status: resp.StatusCode, Title: http.StatusText(resp.StatusCode), RequestID: resp.Header.Get("X-Request-ID")}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == "application/problem+json" {
+		// A malformed problem still leaves the status-based error usable
+		_ = json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(e)
+		e.Status = resp.StatusCode
+	}
+	return e
+}
+
+// transient reports whether err may succeed when tried again
+func transient(err error) bool {
+	if _, ok := errors.AsType[*Error](err); ok {
+		return errors.Is(err, ErrRateLimited) || errors.Is(err, ErrUnavailable)
+	}
+	return true // network error
+}
+
+// sleep waits before retry attempt+1: the server's Retry-After if given,
+// else exponential backoff with full jitter. It gives up early if the wait
+// would outlast ctx.
+func (c *Client) sleep(ctx context.Context, attempt int, retryAfter time.Duration) error {
+	d := retryAfter
+	if d <= 0 {
+		ceiling := min(c.minBackoff<<attempt, c.maxBackoff)
+		d = time.Duration(rand.Int64N(int64(ceiling) + 1))
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < d {
+		return context.DeadlineExceeded
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+func parseRetryAfter(s string) time.Duration {
+	if secs, err := strconv.Atoi(s); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	return 0
+}
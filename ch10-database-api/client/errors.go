@@ -0,0 +1,81 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// Sentinel errors matched by errors.Is against an *Error from the server
+var (
+	ErrBadRequest      = errors.New("bad request")                // 400
+	ErrUnauthenticated = errors.New("unauthenticated")            // 401
+	ErrForbidden       = errors.New("forbidden")                  // 403
+	ErrNotFound        = errors.New("not found")                  // 404
+	ErrConflict        = errors.New("conflict")                   // 409
+	ErrVersionMismatch = errors.New("version mismatch")           // 412
+	ErrTooLarge        = errors.New("request too large")          // 413
+	ErrValidation      = errors.New("validation failed")          // 422
+	ErrRateLimited     = errors.New("rate limited")               // 429
+	ErrUnavailable     = errors.New("server unavailable")         // 502, 503, 504
+	ErrServer          = errors.New("internal server error")      // other 5xx
+	ErrUnexpected      = errors.New("unexpected response status") // anything else
+)
+
+// FieldError is one invalid field of a 422 response
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Error is an RFC 9457 problem returned by the server
+type Error struct {
+	Status   int          `json:"status"`
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Fields   []FieldError `json:"errors,omitempty"`
+
+	// RequestID is the server's X-Request-ID, useful when reporting issues
+	RequestID string `json:"-"`
+}
+
+func (e *Error) Error() string {
+	msg := strconv.Itoa(e.Status) + " " + e.Title
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	return msg
+}
+
+// Unwrap returns the sentinel error for the status code
+func (e *Error) Unwrap() error {
+	switch e.Status {
+	case http.StatusBadRequest:
+		return ErrBadRequest
+	case http.StatusUnauthorized:
+		return ErrUnauthenticated
+	case http.StatusForbidden:
+		return ErrForbidden
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusConflict:
+		return ErrConflict
+	case http.StatusPreconditionFailed:
+		return ErrVersionMismatch
+	case http.StatusRequestEntityTooLarge:
+		return ErrTooLarge
+	case http.StatusUnprocessableEntity:
+		return ErrValidation
+	case http.StatusTooManyRequests:
+		return ErrRateLimited
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return ErrUnavailable
+	}
+	if e.Status >= http.StatusInternalServerError {
+		return ErrServer
+	}
+	return ErrUnexpected
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/forest6511/go-textbook-advanced/ch10-database-api/client"
+)
+
+func newTestClient(t *testing.T, h http.Handler, opts ...client.Option) *client.Client {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	opts = append([]client.Option{client.WithHTTPClient(srv.Client()), client.WithRetry(3, time.Millisecond, 10*time.Millisecond)}, opts...)
+	c, err := client.New(srv.URL, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestClientCRUD(t *testing.T) {
+	auth := newTestAuthenticator(t)
+	token, err := auth.Issue(Principal{UserID: 1, Roles: []string{roleAdmin}}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newTestClient(t, newServer(NewInMemoryUserRepository(), WithAuthenticator(auth)), client.WithToken(token))
+	ctx := t.Context()
+
+	alice, err := c.CreateUser(ctx, client.NewUser{Name: "Alice", Email: "alice@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alice.ID != 1 || alice.Version != 1 || alice.CreatedBy != "user:1" {
+		t.Errorf("created = %+v", alice)
+	}
+	if _, err := c.CreateUser(ctx, client.NewUser{Name: "Imposter", Email: "alice@example.com"}); !errors.Is(err, client.ErrConflict) {
+		t.Errorf("duplicate email: err = %v, want ErrConflict", err)
+	}
+
+	_, err = c.CreateUser(ctx, client.NewUser{Name: "Bob", Email: "not-an-email"})
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || !errors.Is(err, client.ErrValidation) || len(apiErr.Fields) != 1 || apiErr.Fields[0].Field != "email" {
+		t.Errorf("invalid email: err = %#v", err)
+	}
+
+	alice.Name = "Alice Smith"
+	updated, err := c.UpdateUser(ctx, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Version != 2 {
+		t.Errorf("version after update = %d", updated.Version)
+	}
+	if _, err := c.UpdateUser(ctx, alice); !errors.Is(err, client.ErrVersionMismatch) {
+		t.Errorf("stale update: err = %v, want ErrVersionMismatch", err)
+	}
+
+	email := "smith@example.com"
+	patched, err := c.PatchUser(ctx, alice.ID, updated.Version, client.UserPatch{Email: &email})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if patched.Email != email || patched.Name != "Alice Smith" {
+		t.Errorf("patched = %+v", patched)
+	}
+
+	page, err := c.ListUsers(ctx, client.ListOptions{Sort: "-name", Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Users) != 1 || page.Users[0].Email != email {
+		t.Errorf("list = %+v", page)
+	}
+
+	if err := c.DeleteUser(ctx, alice.ID, patched.Version); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetUser(ctx, alice.ID); !errors.Is(err, client.ErrNotFound) {
+		t.Errorf("get deleted: err = %v, want ErrNotFound", err)
+	}
+	if _, err := c.RestoreUser(ctx, alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := c.GetUser(ctx, alice.ID); err != nil || got.Email != email {
+		t.Errorf("get restored = %+v, %v", got, err)
+	}
+
+	anon := newTestClient(t, newServer(NewInMemoryUserRepository(), WithAuthenticator(auth)))
+	if _, err := anon.GetUser(ctx, 1); !errors.Is(err, client.ErrUnauthenticated) {
+		t.Errorf("anonymous: err = %v, want ErrUnauthenticated", err)
+	}
+}
+
+// flaky fails the first n requests with status
+func flaky(n int32, status int) Middleware {
+	var calls atomic.Int32
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) <= n {
+				writeError(w, r, newProblem(status, "try again"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// loseFirstResponse applies the first request but answers it with a 502,
+// as a proxy would after the connection to the server broke. It counts
+// requests in calls.
+func loseFirstResponse(calls *atomic.Int32) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) == 1 {
+				next.ServeHTTP(httptest.NewRecorder(), r)
+				writeError(w, r, newProblem(http.StatusBadGateway, "upstream reset"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	repo := NewInMemoryUserRepository()
+	if err := repo.Save(t.Context(), &User{Name: "Alice", Email: "alice@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	c := newTestClient(t, newServer(repo, WithMiddleware(flaky(2, http.StatusServiceUnavailable))))
+	if _, err := c.GetUser(t.Context(), 1); err != nil {
+		t.Errorf("GET after two 503s: %v", err)
+	}
+
+	// The first POST is applied but its response is lost; the retry carries
+	// the same Idempotency-Key, so it replays instead of creating Bob twice
+	c = newTestClient(t, newServer(repo, WithMiddleware(loseFirstResponse(new(atomic.Int32)))))
+	bob, err := c.CreateUser(t.Context(), client.NewUser{Name: "Bob", Email: "bob@example.com"})
+	if err != nil {
+		t.Fatalf("POST after a lost response: %v", err)
+	}
+	if page, _ := repo.List(t.Context(), ListOptions{}); bob.ID != 2 || len(page.Users) != 2 {
+		t.Errorf("bob = %+v, %d users stored", bob, len(page.Users))
+	}
+
+	c = newTestClient(t, newServer(repo, WithMiddleware(flaky(10, http.StatusServiceUnavailable))))
+	if _, err := c.GetUser(t.Context(), 1); !errors.Is(err, client.ErrUnavailable) {
+		t.Errorf("GET after retries exhausted: err = %v, want ErrUnavailable", err)
+	}
+
+	// Client errors are final
+	var calls atomic.Int32
+	count := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			next.ServeHTTP(w, r)
+		})
+	}
+	c = newTestClient(t, newServer(repo, WithMiddleware(count)))
+	if _, err := c.GetUser(t.Context(), 999); !errors.Is(err, client.ErrNotFound) || calls.Load() != 1 {
+		t.Errorf("404: err = %v after %d calls", err, calls.Load())
+	}
+}
+
+func TestClientDoesNotRetryConditionalWrites(t *testing.T) {
+	repo := NewInMemoryUserRepository()
+	alice := &User{Name: "Alice", Email: "alice@example.com"}
+	if err := repo.Save(t.Context(), alice); err != nil {
+		t.Fatal(err)
+	}
+
+	// A retried update would fail with ErrVersionMismatch, hiding that the
+	// first attempt succeeded
+	var calls atomic.Int32
+	c := newTestClient(t, newServer(repo, WithMiddleware(loseFirstResponse(&calls))))
+	_, err := c.UpdateUser(t.Context(), &client.User{ID: alice.ID, Name: "Alice Smith", Email: alice.Email, Version: alice.Version})
+	if !errors.Is(err, client.ErrUnavailable) || calls.Load() != 1 {
+		t.Errorf("update with lost response: err = %v after %d calls, want ErrUnavailable after 1", err, calls.Load())
+	}
+	if got, _ := repo.FindByID(t.Context(), alice.ID); got.Name != "Alice Smith" || got.Version != 2 {
+		t.Errorf("stored = %+v", got)
+	}
+
+	calls.Store(0)
+	if err := c.DeleteUser(t.Context(), alice.ID, 2); !errors.Is(err, client.ErrUnavailable) || calls.Load() != 1 {
+		t.Errorf("delete with lost response: err = %v after %d calls, want ErrUnavailable after 1", err, calls.Load())
+	}
+	if _, err := repo.FindByID(t.Context(), alice.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("user not deleted: %v", err)
+	}
+}
+
+func TestClientHonorsDeadline(t *testing.T) {
+	// The server asks to wait longer than the caller is willing to
+	retryLater := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Retry-After", "30")
+			writeError(w, r, newProblem(http.StatusTooManyRequests, "slow down"))
+		})
+	}
+	c := newTestClient(t, newServer(NewInMemoryUserRepository(), WithMiddleware(retryLater)))
+
+	ctx, cancel := context.WithTimeout(t.Context(), time.Second)
+	defer cancel()
+	start := time.Now()
+	_, err := c.GetUser(ctx, 1)
+	if !errors.Is(err, client.ErrRateLimited) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want ErrRateLimited and DeadlineExceeded", err)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("gave up after %v; should not wait for a retry past the deadline", d)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+)
+
+// decodeJSON strictly decodes exactly one JSON value from the request body.
+// Size limits are applied by http.MaxBytesHandler in newServer.
+func decodeJSON(r *http.Request, v any) error {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		return newProblem(http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+	}
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return decodeProblem(err)
+	}
+	// Anything but EOF after the first value is trailing data
+	if err := dec.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		if err == nil {
+			return newProblem(http.StatusBadRequest, "request body must contain a single JSON value")
+		}
+		return decodeProblem(err)
+	}
+	return nil
+}
+
+func decodeProblem(err error) *Problem {
+	if tooLarge, ok := errors.AsType[*http.MaxBytesError](err); ok {
+		return newProblem(http.StatusRequestEntityTooLarge, "request body exceeds %d bytes", tooLarge.Limit)
+	}
+	return invalidJSON(err)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDecodeJSON(t *testing.T) {
+	h := newServer(NewInMemoryUserRepository(), WithMaxBodyBytes(64))
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        int
+	}{
+		{"ok", "application/json", `{"name":"A","email":"a@example.com"}`, http.StatusCreated},
+		{"charset param", "application/json; charset=utf-8", `{"name":"B","email":"b@example.com"}`, http.StatusCreated},
+		{"unknown field", "application/json", `{"name":"C","email":"c@example.com","admin":true}`, http.StatusBadRequest},
+		{"trailing value", "application/json", `{"name":"D","email":"d@example.com"} {}`, http.StatusBadRequest},
+		{"trailing garbage", "application/json", `{"name":"E","email":"e@example.com"}x`, http.StatusBadRequest},
+		{"too large", "application/json", `{"name":"` + strings.Repeat("F", 100) + `","email":"f@example.com"}`, http.StatusRequestEntityTooLarge},
+		{"wrong media type", "text/plain", `{"name":"G","email":"g@example.com"}`, http.StatusUnsupportedMediaType},
+		{"missing media type", "", `{"name":"H","email":"h@example.com"}`, http.StatusUnsupportedMediaType},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := doRequest(t, h, http.MethodPost, "/api/users", tc.body, "Content-Type", tc.contentType)
+			if rec.Code != tc.want {
+				t.Errorf("status = %d, want %d; body = %s", rec.Code, tc.want, rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// userETag derives a strong entity tag from the user's version
+func userETag(u *User) string {
+	return strconv.Quote(strconv.Itoa(u.Version))
+}
+
+// gzipETagSuffix marks the entity tag of a gzip-encoded representation,
+// which must differ from the identity one (RFC 9110 8.8.3)
+const gzipETagSuffix = "-gzip"
+
+// setGzipETag adds gzipETagSuffix to a strong ETag in h
+func setGzipETag(h http.Header) {
+	etag := h.Get("ETag")
+	if etag == "" || strings.HasPrefix(etag, "W/") || strings.HasSuffix(etag, gzipETagSuffix+`"`) {
+		return
+	}
+	h.Set("ETag", strings.TrimSuffix(etag, `"`)+gzipETagSuffix+`"`)
+}
+
+// etagMatch reports whether etag appears in an If-Match or If-None-Match
+// header value. If-None-Match uses weak comparison, If-Match strong (RFC 9110 8.8.3.2).
+// Tags of gzip responses match too: both encodings carry the same user version.
+func etagMatch(header, etag string, weak bool) bool {
+	for candidate := range strings.SplitSeq(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if tag, ok := strings.CutSuffix(candidate, gzipETagSuffix+`"`); ok {
+			candidate = tag + `"`
+		}
+		if candidate == "*" {
+			return true
+		}
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+			etag = strings.TrimPrefix(etag, "W/")
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfMatch requires an If-Match header matching the current representation
+func checkIfMatch(r *http.Request, current *User) error {
+	h := r.Header.Get("If-Match")
+	if h == "" {
+		return newProblem(http.StatusPreconditionRequired, "updates require an If-Match header with the current ETag")
+	}
+	if !etagMatch(h, userETag(current), false) {
+		return newProblem(http.StatusPreconditionFailed, "user %d has been modified; fetch it again", current.ID)
+	}
+	return nil
+}
+
+// notModified handles conditional GET; it reports whether a 304 was written
+func notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	h := r.Header.Get("If-None-Match")
+	if h == "" || !etagMatch(h, etag, true) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
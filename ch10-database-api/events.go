@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// EventType names a change to a user
+type EventType string
+
+const (
+	UserCreated  EventType = "user.created"
+	UserUpdated  EventType = "user.updated"
+	UserDeleted  EventType = "user.deleted"
+	UserRestored EventType = "user.restored"
+)
+
+// Event describes a committed repository write. Repositories also keep
+// them as the audit history of each user.
+type Event struct {
+	Type       EventType `json:"type"`
+	UserID     int       `json:"user_id"`
+	User       *User     `json:"user,omitempty"` // state after the write; see PublishingUserRepository
+	Actor      string    `json:"actor,omitempty"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// newEvent describes a write by the actor in ctx. user may be nil when
+// the resulting state is unknown.
+func newEvent(ctx context.Context, typ EventType, id int, user *User) Event {
+	e := Event{Type: typ, UserID: id, Actor: actorFrom(ctx), OccurredAt: time.Now().UTC()}
+	if user != nil {
+		cp := *user
+		e.User = &cp
+		e.OccurredAt = user.UpdatedAt
+	}
+	return e
+}
+
+// Subscriber receives events. Delivery is at least once, so handlers
+// should be idempotent.
+type Subscriber interface {
+	Handle(ctx context.Context, e Event) error
+}
+
+// SubscriberFunc adapts a function to Subscriber
+type SubscriberFunc func(ctx context.Context, e Event) error
+
+func (f SubscriberFunc) Handle(ctx context.Context, e Event) error { return f(ctx, e) }
+
+// EventBus fans events out to its subscribers in registration order
+type EventBus struct {
+	mu   sync.RWMutex
+	subs []Subscriber
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{}
+}
+
+func (b *EventBus) Subscribe(s Subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subs = append(b.subs, s)
+}
+
+// Publish delivers e to every subscriber and joins their errors
+func (b *EventBus) Publish(ctx context.Context, e Event) error {
+	b.mu.RLock()
+	subs := b.subs
+	b.mu.RUnlock()
+	var errs []error
+	for _, s := range subs {
+		if err := s.Handle(ctx, e); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// PublishingUserRepository publishes an event after each successful write to
+// a repository without an outbox. Inside WithTx events are held back until
+// the transaction commits. Delivery is best effort: a failing subscriber is
+// logged and the write still succeeds. Delete events carry no User, since
+// Delete does not return the deleted state.
+type PublishingUserRepository struct {
+	UserRepository
+	bus *EventBus
+}
+
+func NewPublishingUserRepository(next UserRepository, bus *EventBus) *PublishingUserRepository {
+	return &PublishingUserRepository{UserRepository: next, bus: bus}
+}
+
+func (p *PublishingUserRepository) publish(ctx context.Context, events ...Event) {
+	// The write is done; do not let a canceled request drop its events
+	ctx = context.WithoutCancel(ctx)
+	for _, e := range events {
+		if err := p.bus.Publish(ctx, e); err != nil {
+			logger.Error("publish event failed",
+				slog.String("type", string(e.Type)),
+				slog.Int("user_id", e.UserID),
+				slog.Any("err", err),
+			)
+		}
+	}
+}
+
+func (p *PublishingUserRepository) Save(ctx context.Context, user *User) error {
+	if err := p.UserRepository.Save(ctx, user); err != nil {
+		return err
+	}
+	p.publish(ctx, newEvent(ctx, UserCreated, user.ID, user))
+	return nil
+}
+
+func (p *PublishingUserRepository) Update(ctx context.Context, user *User) error {
+	if err := p.UserRepository.Update(ctx, user); err != nil {
+		return err
+	}
+	p.publish(ctx, newEvent(ctx, UserUpdated, user.ID, user))
+	return nil
+}
+
+func (p *PublishingUserRepository) Delete(ctx context.Context, id int) error {
+	if err := p.UserRepository.Delete(ctx, id); err != nil {
+		return err
+	}
+	p.publish(ctx, newEvent(ctx, UserDeleted, id, nil))
+	return nil
+}
+
+func (p *PublishingUserRepository) Restore(ctx context.Context, id int) (*User, error) {
+	u, err := p.UserRepository.Restore(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	p.publish(ctx, newEvent(ctx, UserRestored, id, u))
+	return u, nil
+}
+
+// WithTx collects the events of fn and publishes them only after commit
+func (p *PublishingUserRepository) WithTx(ctx context.Context, fn func(repo UserRepository) error) error {
+	var pending []Event
+	err := withTx(ctx, p.UserRepository, func(repo UserRepository) error {
+		return fn(&eventRecorder{UserRepository: repo, events: &pending})
+	})
+	if err != nil {
+		return err
+	}
+	p.publish(ctx, pending...)
+	return nil
+}
+
+// eventRecorder appends an event for each successful write through it
+type eventRecorder struct {
+	UserRepository
+	events *[]Event
+}
+
+func (r *eventRecorder) Save(ctx context.Context, user *User) error {
+	if err := r.UserRepository.Save(ctx, user); err != nil {
+		return err
+	}
+	*r.events = append(*r.events, newEvent(ctx, UserCreated, user.ID, user))
+	return nil
+}
+
+func (r *eventRecorder) Update(ctx context.Context, user *User) error {
+	if err := r.UserRepository.Update(ctx, user); err != nil {
+		return err
+	}
+	*r.events = append(*r.events, newEvent(ctx, UserUpdated, user.ID, user))
+	return nil
+}
+
+func (r *eventRecorder) Delete(ctx context.Context, id int) error {
+	if err := r.UserRepository.Delete(ctx, id); err != nil {
+		return err
+	}
+	*r.events = append(*r.events, newEvent(ctx, UserDeleted, id, nil))
+	return nil
+}
+
+func (r *eventRecorder) Restore(ctx context.Context, id int) (*User, error) {
+	u, err := r.UserRepository.Restore(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	*r.events = append(*r.events, newEvent(ctx, UserRestored, id, u))
+	return u, nil
+}
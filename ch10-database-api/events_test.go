@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// eventLog is a Subscriber that remembers what it received
+type eventLog struct {
+	mu     sync.Mutex
+	events []Event
+	fail   error
+}
+
+func (l *eventLog) Handle(ctx context.Context, e Event) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.fail != nil {
+		return l.fail
+	}
+	l.events = append(l.events, e)
+	return nil
+}
+
+func (l *eventLog) types() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var types []string
+	for _, e := range l.events {
+		types = append(types, string(e.Type))
+	}
+	return types
+}
+
+// writeAll performs a create, an update, a rolled-back create and a delete
+func writeAll(t *testing.T, repo UserRepository) {
+	t.Helper()
+	u := &User{Name: "Alice", Email: "alice@example.com"}
+	if err := repo.Save(t.Context(), u); err != nil {
+		t.Fatal(err)
+	}
+	u.Name = "Alice Smith"
+	if err := repo.Update(t.Context(), u); err != nil {
+		t.Fatal(err)
+	}
+	errAbort := errors.New("abort")
+	err := withTx(t.Context(), repo, func(repo UserRepository) error {
+		if err := repo.Save(t.Context(), &User{Name: "Bob", Email: "bob@example.com"}); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("WithTx: err = %v, want errAbort", err)
+	}
+	// A failed write emits nothing
+	if err := repo.Update(t.Context(), &User{ID: 999, Name: "X", Email: "x@example.com"}); err == nil {
+		t.Fatal("Update of missing user succeeded")
+	}
+	if err := repo.Delete(t.Context(), u.ID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+var wantEvents = []string{"user.created", "user.updated", "user.deleted"}
+
+func TestPublishingUserRepository(t *testing.T) {
+	bus := NewEventBus()
+	log := &eventLog{}
+	bus.Subscribe(log)
+
+	writeAll(t, NewPublishingUserRepository(NewInMemoryUserRepository(), bus))
+
+	if got := log.types(); !slices.Equal(got, wantEvents) {
+		t.Errorf("events = %v, want %v", got, wantEvents)
+	}
+	if u := log.events[1].User; u == nil || u.Name != "Alice Smith" || u.Version != 2 {
+		t.Errorf("update event user = %+v", u)
+	}
+}
+
+func TestOutboxRelay(t *testing.T) {
+	repo := newTestSQLRepository(t)
+	bus := NewEventBus()
+	log := &eventLog{}
+	bus.Subscribe(log)
+	relay := NewOutboxRelay(repo.db, bus, 0)
+
+	writeAll(t, repo)
+	if len(log.types()) != 0 {
+		t.Fatal("events published before the relay ran")
+	}
+
+	// A failing subscriber leaves the events in the outbox
+	log.fail = errors.New("unavailable")
+	if n, err := relay.RelayOnce(t.Context()); err == nil || n != 0 {
+		t.Fatalf("RelayOnce with failing subscriber = %d, %v", n, err)
+	}
+
+	log.fail = nil
+	n, err := relay.RelayOnce(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(wantEvents) {
+		t.Errorf("relayed %d events, want %d", n, len(wantEvents))
+	}
+	if got := log.types(); !slices.Equal(got, wantEvents) {
+		t.Errorf("events = %v, want %v", got, wantEvents)
+	}
+
+	// Delivered events are removed
+	if n, err := relay.RelayOnce(t.Context()); err != nil || n != 0 {
+		t.Errorf("second RelayOnce = %d, %v; want 0, nil", n, err)
+	}
+}
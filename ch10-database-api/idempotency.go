@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"maps"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// idempotencyEntry is the first response recorded for a key
+type idempotencyEntry struct {
+	fingerprint [sha256.Size]byte
+	done        bool // false while the first request is in flight
+	expires     time.Time
+
+	status int
+	header http.Header
+	body   []byte
+}
+
+// idempotencyStore remembers responses per client and key for a TTL
+type idempotencyStore struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu        sync.Mutex
+	entries   map[string]*idempotencyEntry
+	lastSweep time.Time
+}
+
+func newIdempotencyStore(ttl time.Duration) *idempotencyStore {
+	return &idempotencyStore{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]*idempotencyEntry),
+	}
+}
+
+// begin returns the existing entry for key, or reserves a new one and
+// returns nil, in which case the caller must finish or abandon it
+func (s *idempotencyStore) begin(key string, fp [sha256.Size]byte) *idempotencyEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	s.sweep(now)
+	if e, ok := s.entries[key]; ok && !e.expired(now) {
+		cp := *e
+		return &cp
+	}
+	s.entries[key] = &idempotencyEntry{fingerprint: fp}
+	return nil
+}
+
+// sweep evicts expired entries at most once a minute, so a request does
+// not pay for scanning every stored key; s.mu must be held
+func (s *idempotencyStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for k, e := range s.entries {
+		if e.expired(now) {
+			delete(s.entries, k)
+		}
+	}
+}
+
+func (e *idempotencyEntry) expired(now time.Time) bool {
+	return e.done && now.After(e.expires)
+}
+
+func (s *idempotencyStore) finish(key string, status int, header http.Header, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := s.entries[key]
+	e.done = true
+	e.expires = s.now().Add(s.ttl)
+	e.status, e.header, e.body = status, header, body
+}
+
+// abandon forgets a reservation so the client may retry
+func (s *idempotencyStore) abandon(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+}
+
+// idempotent replays the first response for a repeated Idempotency-Key.
+// Reusing a key with a different body is rejected with 422.
+func idempotent(store *idempotencyStore) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(idempotencyKeyHeader)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > 255 {
+				writeError(w, r, newProblem(http.StatusBadRequest, "%s must be at most 255 characters", idempotencyKeyHeader))
+				return
+			}
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				writeError(w, r, decodeProblem(err))
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			h := sha256.New()
+			io.WriteString(h, r.Method+" "+r.URL.Path+"\n")
+			h.Write(body)
+			var fp [sha256.Size]byte
+			h.Sum(fp[:0])
+
+			// Keys are scoped per client so users cannot replay each other's responses
+			scoped := clientKey(r) + "\n" + key
+			switch e := store.begin(scoped, fp); {
+			case e == nil:
+				// first request with this key
+			case e.fingerprint != fp:
+				writeError(w, r, newProblem(http.StatusUnprocessableEntity,
+					"%s was already used with a different request", idempotencyKeyHeader))
+				return
+			case !e.done:
+				writeError(w, r, newProblem(http.StatusConflict,
+					"a request with this %s is still in progress", idempotencyKeyHeader))
+				return
+			default:
+				maps.Copy(w.Header(), e.header)
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(e.status)
+				w.Write(e.body)
+				return
+			}
+
+			rec := &bodyRecorder{statusRecorder: statusRecorder{ResponseWriter: w}}
+			defer func() {
+				// Server errors and panics are not final; let the client retry
+				if rec.status == 0 || rec.status >= http.StatusInternalServerError {
+					store.abandon(scoped)
+					return
+				}
+				store.finish(scoped, rec.status, rec.header, rec.body.Bytes())
+			}()
+			next.ServeHTTP(rec, r)
+		})
+	}
+}
+
+// bodyRecorder captures the response while passing it through
+type bodyRecorder struct {
+	statusRecorder
+	header http.Header
+	body   bytes.Buffer
+}
+
+// replayedHeaders describe the resource; others (request ID, rate limit) are per request
+var replayedHeaders = []string{"Content-Type", "ETag", "Location"}
+
+func (rec *bodyRecorder) WriteHeader(status int) {
+	if rec.header == nil {
+		rec.header = make(http.Header)
+		for _, k := range replayedHeaders {
+			for _, v := range rec.Header().Values(k) {
+				rec.header.Add(k, v)
+			}
+		}
+	}
+	rec.statusRecorder.WriteHeader(status)
+}
+
+func (rec *bodyRecorder) Write(b []byte) (int, error) {
+	if rec.header == nil {
+		rec.WriteHeader(http.StatusOK)
+	}
+	rec.body.Write(b)
+	return rec.statusRecorder.Write(b)
+}
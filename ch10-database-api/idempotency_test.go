@@ -0,0 +1,90 @@
+package main
+
+import (
+	"maps"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyKey(t *testing.T) {
+	repo := NewInMemoryUserRepository()
+	h := newServer(repo)
+	body := `{"name":"Alice","email":"alice@example.com"}`
+
+	first := doRequest(t, h, http.MethodPost, "/api/users", body, idempotencyKeyHeader, "k1")
+	if first.Code != http.StatusCreated {
+		t.Fatalf("first: status = %d, body = %s", first.Code, first.Body)
+	}
+
+	retry := doRequest(t, h, http.MethodPost, "/api/users", body, idempotencyKeyHeader, "k1")
+	if retry.Code != http.StatusCreated || retry.Body.String() != first.Body.String() {
+		t.Errorf("retry: status = %d, body = %s; want replay of %s", retry.Code, retry.Body, first.Body)
+	}
+	if retry.Header().Get("Idempotent-Replayed") != "true" || retry.Header().Get("ETag") != first.Header().Get("ETag") {
+		t.Errorf("retry headers = %v", retry.Header())
+	}
+	if page, _ := repo.List(t.Context(), ListOptions{}); len(page.Users) != 1 {
+		t.Errorf("%d users stored, want 1", len(page.Users))
+	}
+
+	other := `{"name":"Bob","email":"bob@example.com"}`
+	if rec := doRequest(t, h, http.MethodPost, "/api/users", other, idempotencyKeyHeader, "k1"); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("reused key with different body: status = %d, want 422", rec.Code)
+	}
+	if rec := doRequest(t, h, http.MethodPost, "/api/users", other, idempotencyKeyHeader, "k2"); rec.Code != http.StatusCreated {
+		t.Errorf("new key: status = %d, want 201", rec.Code)
+	}
+}
+
+func TestIdempotencyStoreExpiry(t *testing.T) {
+	now := time.Unix(0, 0)
+	s := newIdempotencyStore(time.Minute)
+	s.now = func() time.Time { return now }
+
+	var fp [32]byte
+	if e := s.begin("k", fp); e != nil {
+		t.Fatal("new key returned an entry")
+	}
+	if e := s.begin("k", fp); e == nil || e.done {
+		t.Fatalf("in-flight key: entry = %+v", e)
+	}
+	s.finish("k", http.StatusCreated, http.Header{}, []byte("{}"))
+	if e := s.begin("k", fp); e == nil || !e.done {
+		t.Fatalf("finished key: entry = %+v", e)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if e := s.begin("k", fp); e != nil {
+		t.Error("expired key was replayed")
+	}
+}
+
+func TestIdempotencyStoreSweep(t *testing.T) {
+	now := time.Unix(0, 0)
+	s := newIdempotencyStore(time.Second)
+	s.now = func() time.Time { return now }
+
+	var fp [32]byte
+	for _, k := range []string{"a", "b", "c"} {
+		s.begin(k, fp)
+		s.finish(k, http.StatusCreated, http.Header{}, nil)
+	}
+	s.begin("in-flight", fp)
+
+	// Expired entries linger until the next sweep, but are not replayed
+	now = now.Add(30 * time.Second)
+	if e := s.begin("a", fp); e != nil {
+		t.Error("expired key was replayed")
+	}
+	if len(s.entries) != 4 {
+		t.Errorf("swept before the interval: %d entries", len(s.entries))
+	}
+
+	now = now.Add(time.Minute)
+	s.begin("d", fp)
+	if _, ok := s.entries["b"]; ok || len(s.entries) != 3 {
+		t.Errorf("after sweep: %v", slices.Sorted(maps.Keys(s.entries)))
+	}
+}
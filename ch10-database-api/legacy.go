@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+// LegacyUserRepository is the repository interface before context support
+type LegacyUserRepository interface {
+	FindByID(id int) (*User, error)
+	Save(user *User) error
+	Update(user *User) error
+	Delete(id int) error
+	List(opts ListOptions) (*UserPage, error)
+}
+
+// FromLegacy adapts a LegacyUserRepository to UserRepository. The context is
+// checked before each call; a call already in progress cannot be interrupted.
+// Restore and History are forwarded when the legacy type has them and fail
+// with errors.ErrUnsupported otherwise.
+func FromLegacy(repo LegacyUserRepository) UserRepository {
+	return legacyAdapter{repo}
+}
+
+type legacyAdapter struct {
+	legacy LegacyUserRepository
+}
+
+func (a legacyAdapter) FindByID(ctx context.Context, id int) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return a.legacy.FindByID(id)
+}
+
+func (a legacyAdapter) Save(ctx context.Context, user *User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return a.legacy.Save(user)
+}
+
+func (a legacyAdapter) Update(ctx context.Context, user *User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return a.legacy.Update(user)
+}
+
+func (a legacyAdapter) Delete(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return a.legacy.Delete(id)
+}
+
+func (a legacyAdapter) List(ctx context.Context, opts ListOptions) (*UserPage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return a.legacy.List(opts)
+}
+
+func (a legacyAdapter) Restore(ctx context.Context, id int) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if r, ok := a.legacy.(interface{ Restore(id int) (*User, error) }); ok {
+		return r.Restore(id)
+	}
+	return nil, errors.ErrUnsupported
+}
+
+func (a legacyAdapter) History(ctx context.Context, id int) ([]Event, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if h, ok := a.legacy.(interface{ History(id int) ([]Event, error) }); ok {
+		return h.History(id)
+	}
+	return nil, errors.ErrUnsupported
+}
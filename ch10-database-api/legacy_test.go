@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// oldRepo implements LegacyUserRepository on top of the in-memory repository
+type oldRepo struct{ r *InMemoryUserRepository }
+
+func (o oldRepo) FindByID(id int) (*User, error) { return o.r.FindByID(context.Background(), id) }
+func (o oldRepo) Save(u *User) error             { return o.r.Save(context.Background(), u) }
+func (o oldRepo) Update(u *User) error           { return o.r.Update(context.Background(), u) }
+func (o oldRepo) Delete(id int) error            { return o.r.Delete(context.Background(), id) }
+func (o oldRepo) List(opts ListOptions) (*UserPage, error) {
+	return o.r.List(context.Background(), opts)
+}
+
+func TestRepositoriesHonorCancellation(t *testing.T) {
+	repos := map[string]UserRepository{
+		"memory": NewInMemoryUserRepository(),
+		"sql":    newTestSQLRepository(t),
+		"legacy": FromLegacy(oldRepo{NewInMemoryUserRepository()}),
+	}
+	for name, repo := range repos {
+		t.Run(name, func(t *testing.T) {
+			u := &User{Name: "Alice", Email: "alice@example.com"}
+			if err := repo.Save(t.Context(), u); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithCancel(t.Context())
+			cancel()
+			if _, err := repo.FindByID(ctx, u.ID); !errors.Is(err, context.Canceled) {
+				t.Errorf("FindByID: err = %v, want context.Canceled", err)
+			}
+			if err := repo.Save(ctx, &User{Name: "Bob", Email: "bob@example.com"}); !errors.Is(err, context.Canceled) {
+				t.Errorf("Save: err = %v, want context.Canceled", err)
+			}
+			if err := repo.Update(ctx, u); !errors.Is(err, context.Canceled) {
+				t.Errorf("Update: err = %v, want context.Canceled", err)
+			}
+			if err := repo.Delete(ctx, u.ID); !errors.Is(err, context.Canceled) {
+				t.Errorf("Delete: err = %v, want context.Canceled", err)
+			}
+			if _, err := repo.List(ctx, ListOptions{}); !errors.Is(err, context.Canceled) {
+				t.Errorf("List: err = %v, want context.Canceled", err)
+			}
+
+			// Nothing was written through the canceled context
+			page, err := repo.List(t.Context(), ListOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(page.Users) != 1 || page.Users[0].Version != 1 {
+				t.Errorf("users after canceled writes = %+v", page.Users)
+			}
+		})
+	}
+}
+
+func TestHandlerPassesRequestContext(t *testing.T) {
+	h := newServer(NewInMemoryUserRepository())
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	req := httptest.NewRequestWithContext(ctx, http.MethodGet, "/api/users", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+}
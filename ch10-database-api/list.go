@@ -0,0 +1,124 @@
+package main
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// SortOrder selects the list ordering; ID always breaks ties
+type SortOrder struct {
+	Field string // "id", "name" or "email"
+	Desc  bool
+}
+
+// parseSortOrder parses "name" or "-name" style sort parameters
+func parseSortOrder(s string) (SortOrder, error) {
+	var o SortOrder
+	if rest, ok := strings.CutPrefix(s, "-"); ok {
+		o.Desc = true
+		s = rest
+	}
+	switch s {
+	case "", "id":
+		o.Field = "id"
+	case "name", "email":
+		o.Field = s
+	default:
+		return SortOrder{}, fmt.Errorf("unknown sort field %q", s)
+	}
+	return o, nil
+}
+
+func (o SortOrder) String() string {
+	if o.Desc {
+		return "-" + o.Field
+	}
+	return o.Field
+}
+
+// key returns the value of the sort field for u
+func (o SortOrder) key(u *User) string {
+	switch o.Field {
+	case "name":
+		return u.Name
+	case "email":
+		return u.Email
+	}
+	return ""
+}
+
+// compare orders u relative to the position (key, id)
+func (o SortOrder) compare(u *User, key string, id int) int {
+	c := cmp.Or(strings.Compare(o.key(u), key), cmp.Compare(u.ID, id))
+	if o.Desc {
+		return -c
+	}
+	return c
+}
+
+// Cursor is a keyset pagination position: the last row of the previous page
+type Cursor struct {
+	Sort string `json:"s"`
+	Key  string `json:"k,omitempty"`
+	ID   int    `json:"id"`
+}
+
+func cursorAfter(o SortOrder, u *User) *Cursor {
+	return &Cursor{Sort: o.String(), Key: o.key(u), ID: u.ID}
+}
+
+// encodeCursor returns an opaque token for clients
+func encodeCursor(c *Cursor) string {
+	if c == nil {
+		return ""
+	}
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string, o SortOrder) (*Cursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("malformed cursor: %w", err)
+	}
+	var c Cursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("malformed cursor: %w", err)
+	}
+	if c.Sort != o.String() {
+		return nil, fmt.Errorf("cursor was issued for sort %q", c.Sort)
+	}
+	return &c, nil
+}
+
+// ListOptions controls filtering, sorting and pagination for List
+type ListOptions struct {
+	Name  string // case-insensitive substring match
+	Email string // case-insensitive substring match
+	Sort  SortOrder
+	After *Cursor
+	Limit int // <= 0 means no limit
+
+	IncludeDeleted bool // soft-deleted users are hidden unless set
+}
+
+func (o ListOptions) matches(u *User) bool {
+	return (o.IncludeDeleted || u.DeletedAt == nil) &&
+		containsFold(u.Name, o.Name) && containsFold(u.Email, o.Email)
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// UserPage is one page of List results
+type UserPage struct {
+	Users []*User
+	Next  *Cursor // nil on the last page
+}
@@ -1,124 +1,813 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"expvar"
+	"flag"
 	"fmt"
-	"io"
 	"log/slog"
 	"net/http"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 // User domain model
 type User struct {
 	ID    int    `json:"id"`
-	Name  string `json:"name"`
-	Email string `json:"email"`
+	Name  string `json:"name" validate:"required,max=100"`
+	Email string `json:"email" validate:"required,email,max=254"`
+
+	// Version increases on every update and backs the ETag
+	Version int `json:"version"`
+
+	// Set by the repository on each write; clients cannot change them.
+	// The *By fields name the actor, e.g. "user:1", and are empty when
+	// authentication is disabled.
+	CreatedAt time.Time  `json:"created_at"`
+	CreatedBy string     `json:"created_by,omitempty"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	UpdatedBy string     `json:"updated_by,omitempty"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	DeletedBy string     `json:"deleted_by,omitempty"`
 }
 
-// UserRepository interface (Repository pattern)
+// UserRepository interface (Repository pattern). Implementations must give
+// up promptly once ctx is done and return its error.
 type UserRepository interface {
-	FindByID(id int) (*User, error)
-	Save(user *User) error
+	FindByID(ctx context.Context, id int) (*User, error)
+	Save(ctx context.Context, user *User) error
+	Update(ctx context.Context, user *User) error
+	Delete(ctx context.Context, id int) error // soft delete; see Restore
+	Restore(ctx context.Context, id int) (*User, error)
+	History(ctx context.Context, id int) ([]Event, error)
+	List(ctx context.Context, opts ListOptions) (*UserPage, error)
 }
 
-// InMemoryUserRepository is an in-memory implementation
+// InMemoryUserRepository is an in-memory implementation, safe for concurrent use.
+// It stores and returns copies so callers never share a *User with the map.
 type InMemoryUserRepository struct {
-	users  map[int]*User
-	nextID int
+	writeMu sync.Mutex // serializes writers, including whole transactions
+	mu      sync.RWMutex
+	users   map[int]*User  // including soft-deleted users
+	emails  map[string]int // lower-cased email -> ID of a live user, enforces uniqueness
+	history map[int][]Event
+	nextID  int
+
+	// parent is the live repository when r is a transaction. The maps then
+	// only hold the transaction's changes; see WithTx.
+	parent *InMemoryUserRepository
 }
 
 func NewInMemoryUserRepository() *InMemoryUserRepository {
-	return &InMemoryUserRepository{users: make(map[int]*User)}
+	return &InMemoryUserRepository{
+		users:   make(map[int]*User),
+		emails:  make(map[string]int),
+		history: make(map[int][]Event),
+	}
 }
 
-var ErrNotFound = errors.New("not found")
+// user looks up id, falling back to the parent of a transaction; r.mu must be held
+func (r *InMemoryUserRepository) user(id int) (*User, bool) {
+	if u, ok := r.users[id]; ok || r.parent == nil {
+		return u, ok
+	}
+	return r.parent.user(id)
+}
 
-func (r *InMemoryUserRepository) FindByID(id int) (*User, error) {
-	u, ok := r.users[id]
-	if !ok {
+// eachUser calls fn for every stored user, including soft-deleted ones; r.mu must be held
+func (r *InMemoryUserRepository) eachUser(fn func(u *User)) {
+	for _, u := range r.users {
+		fn(u)
+	}
+	if r.parent != nil {
+		r.parent.eachUser(func(u *User) {
+			if _, changed := r.users[u.ID]; !changed {
+				fn(u)
+			}
+		})
+	}
+}
+
+// events returns the history of id, parent's first; r.mu must be held
+func (r *InMemoryUserRepository) events(id int) ([]Event, bool) {
+	h, ok := r.history[id]
+	if r.parent == nil {
+		return h, ok
+	}
+	ph, pok := r.parent.events(id)
+	return append(slices.Clip(ph), h...), ok || pok
+}
+
+// emailOwner returns the live user that owns the lower-cased email; r.mu must be held
+func (r *InMemoryUserRepository) emailOwner(email string) (int, bool) {
+	if id, ok := r.emails[email]; ok || r.parent == nil {
+		return id, ok && id != 0 // 0 marks an email freed in a transaction
+	}
+	return r.parent.emailOwner(email)
+}
+
+// freeEmail releases email; r.mu must be held
+func (r *InMemoryUserRepository) freeEmail(email string) {
+	if r.parent == nil {
+		delete(r.emails, strings.ToLower(email))
+		return
+	}
+	r.emails[strings.ToLower(email)] = 0
+}
+
+// checkEmail fails with ErrConflict if another user owns email; r.mu must be held
+func (r *InMemoryUserRepository) checkEmail(email string, id int) error {
+	if owner, ok := r.emailOwner(strings.ToLower(email)); ok && owner != id {
+		return fmt.Errorf("email %q: %w", email, ErrConflict)
+	}
+	return nil
+}
+
+// store saves a copy of u and appends e to its history; r.mu must be held
+func (r *InMemoryUserRepository) store(u *User, e Event) {
+	cp := *u
+	r.users[u.ID] = &cp
+	r.history[u.ID] = append(r.history[u.ID], e)
+}
+
+var (
+	ErrNotFound        = errors.New("not found")
+	ErrVersionMismatch = errors.New("version mismatch")
+	ErrConflict        = errors.New("conflict")
+)
+
+func (r *InMemoryUserRepository) FindByID(ctx context.Context, id int) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	u, ok := r.user(id)
+	if !ok || u.DeletedAt != nil {
 		return nil, fmt.Errorf("user %d: %w", id, ErrNotFound)
 	}
-	return u, nil
+	cp := *u
+	return &cp, nil
 }
 
-func (r *InMemoryUserRepository) Save(user *User) error {
+func (r *InMemoryUserRepository) Save(ctx context.Context, user *User) error {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+	if err := ctx.Err(); err != nil { // may have expired while waiting
+		return fmt.Errorf("save user: %w", err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.checkEmail(user.Email, 0); err != nil {
+		return fmt.Errorf("save user: %w", err)
+	}
 	r.nextID++
+	now, actor := time.Now().UTC(), actorFrom(ctx)
 	user.ID = r.nextID
-	r.users[user.ID] = user
+	user.Version = 1
+	user.CreatedAt, user.CreatedBy = now, actor
+	user.UpdatedAt, user.UpdatedBy = now, actor
+	user.DeletedAt, user.DeletedBy = nil, ""
+	r.store(user, newEvent(ctx, UserCreated, user.ID, user))
+	r.emails[strings.ToLower(user.Email)] = user.ID
+	return nil
+}
+
+// Update succeeds only if user.Version matches the stored version
+func (r *InMemoryUserRepository) Update(ctx context.Context, user *User) error {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+	if err := ctx.Err(); err != nil { // may have expired while waiting
+		return fmt.Errorf("update user %d: %w", user.ID, err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	current, ok := r.user(user.ID)
+	if !ok || current.DeletedAt != nil {
+		return fmt.Errorf("user %d: %w", user.ID, ErrNotFound)
+	}
+	if current.Version != user.Version {
+		return fmt.Errorf("user %d: have version %d, stored %d: %w", user.ID, user.Version, current.Version, ErrVersionMismatch)
+	}
+	if err := r.checkEmail(user.Email, user.ID); err != nil {
+		return fmt.Errorf("update user %d: %w", user.ID, err)
+	}
+	user.Version++
+	user.CreatedAt, user.CreatedBy = current.CreatedAt, current.CreatedBy
+	user.UpdatedAt, user.UpdatedBy = time.Now().UTC(), actorFrom(ctx)
+	user.DeletedAt, user.DeletedBy = nil, ""
+	r.freeEmail(current.Email)
+	r.store(user, newEvent(ctx, UserUpdated, user.ID, user))
+	r.emails[strings.ToLower(user.Email)] = user.ID
+	return nil
+}
+
+// Delete is a soft delete: the user is hidden and its email freed, but it
+// can be brought back with Restore
+func (r *InMemoryUserRepository) Delete(ctx context.Context, id int) error {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+	if err := ctx.Err(); err != nil { // may have expired while waiting
+		return fmt.Errorf("delete user %d: %w", id, err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	current, ok := r.user(id)
+	if !ok || current.DeletedAt != nil {
+		return fmt.Errorf("user %d: %w", id, ErrNotFound)
+	}
+	u := *current
+	now, actor := time.Now().UTC(), actorFrom(ctx)
+	u.Version++
+	u.UpdatedAt, u.UpdatedBy = now, actor
+	u.DeletedAt, u.DeletedBy = &now, actor
+	r.freeEmail(u.Email)
+	r.store(&u, newEvent(ctx, UserDeleted, id, &u))
 	return nil
 }
 
+// Restore undoes a Delete. It fails with ErrConflict if the user is not
+// deleted or its email has been taken since.
+func (r *InMemoryUserRepository) Restore(ctx context.Context, id int) (*User, error) {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+	if err := ctx.Err(); err != nil { // may have expired while waiting
+		return nil, fmt.Errorf("restore user %d: %w", id, err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	current, ok := r.user(id)
+	if !ok {
+		return nil, fmt.Errorf("user %d: %w", id, ErrNotFound)
+	}
+	if current.DeletedAt == nil {
+		return nil, fmt.Errorf("restore user %d: not deleted: %w", id, ErrConflict)
+	}
+	if err := r.checkEmail(current.Email, id); err != nil {
+		return nil, fmt.Errorf("restore user %d: %w", id, err)
+	}
+	u := *current
+	u.Version++
+	u.UpdatedAt, u.UpdatedBy = time.Now().UTC(), actorFrom(ctx)
+	u.DeletedAt, u.DeletedBy = nil, ""
+	r.store(&u, newEvent(ctx, UserRestored, id, &u))
+	r.emails[strings.ToLower(u.Email)] = id
+	return &u, nil
+}
+
+// History returns the changes to a user, oldest first, including after deletion
+func (r *InMemoryUserRepository) History(ctx context.Context, id int) ([]Event, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	h, ok := r.events(id)
+	if !ok {
+		return nil, fmt.Errorf("user %d: %w", id, ErrNotFound)
+	}
+	return slices.Clone(h), nil
+}
+
+func (r *InMemoryUserRepository) List(ctx context.Context, opts ListOptions) (*UserPage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("list users: %w", err)
+	}
+	r.mu.RLock()
+	var users []*User
+	r.eachUser(func(u *User) {
+		if !opts.matches(u) {
+			return
+		}
+		if opts.After != nil && opts.Sort.compare(u, opts.After.Key, opts.After.ID) <= 0 {
+			return
+		}
+		cp := *u
+		users = append(users, &cp)
+	})
+	r.mu.RUnlock()
+
+	slices.SortFunc(users, func(a, b *User) int {
+		return opts.Sort.compare(a, opts.Sort.key(b), b.ID)
+	})
+
+	page := &UserPage{Users: users}
+	if opts.Limit > 0 && len(users) > opts.Limit {
+		page.Users = users[:opts.Limit]
+		page.Next = cursorAfter(opts.Sort, page.Users[opts.Limit-1])
+	}
+	return page, nil
+}
+
 // Handlers
 var logger = slog.New(slog.NewJSONHandler(os.Stdout, nil))
 
+// writeJSON encodes v; *Problem values are sent as application/problem+json
 func writeJSON(w http.ResponseWriter, status int, v any) {
-	w.Header().Set("Content-Type", "application/json")
+	contentType := "application/json"
+	if _, ok := v.(*Problem); ok {
+		contentType = problemContentType
+	}
+	w.Header().Set("Content-Type", contentType)
 	w.WriteHeader(status)
 	if err := json.NewEncoder(w).Encode(v); err != nil {
 		logger.Error("json encode failed", "err", err)
 	}
 }
 
+// pathID parses the {id} path segment
+func pathID(r *http.Request) (int, error) {
+	idStr := r.PathValue("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return 0, newProblem(http.StatusBadRequest, "invalid id %q", idStr)
+	}
+	return id, nil
+}
+
 func getUserHandler(repo UserRepository) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		idStr := r.PathValue("id")
-		id, err := strconv.Atoi(idStr)
+		id, err := pathID(r)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		user, err := repo.FindByID(r.Context(), id)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		etag := userETag(user)
+		w.Header().Set("ETag", etag)
+		if notModified(w, r, etag) {
+			return
+		}
+		writeJSON(w, http.StatusOK, user)
+	}
+}
+
+func createUserHandler(repo UserRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var user User
+		if err := decodeJSON(r, &user); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		if err := validate(&user); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		if err := repo.Save(r.Context(), &user); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		w.Header().Set("ETag", userETag(&user))
+		writeJSON(w, http.StatusCreated, user)
+	}
+}
+
+// userPatch holds the fields a PATCH request may change; nil means unchanged
+type userPatch struct {
+	Name  *string `json:"name"`
+	Email *string `json:"email"`
+}
+
+func (p userPatch) apply(u *User) {
+	if p.Name != nil {
+		u.Name = *p.Name
+	}
+	if p.Email != nil {
+		u.Email = *p.Email
+	}
+}
+
+// userListResponse is a page of users plus the cursor for the next page
+type userListResponse struct {
+	Users      []*User `json:"users"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+func listUsersHandler(repo UserRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		sort, err := parseSortOrder(q.Get("sort"))
 		if err != nil {
-			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid id"})
+			writeError(w, r, newProblem(http.StatusBadRequest, "%v", err))
 			return
 		}
-		user, err := repo.FindByID(id)
+		after, err := decodeCursor(q.Get("cursor"), sort)
 		if err != nil {
-			if errors.Is(err, ErrNotFound) {
-				writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+			writeError(w, r, newProblem(http.StatusBadRequest, "%v", err))
+			return
+		}
+		limit := defaultPageSize
+		if s := q.Get("limit"); s != "" {
+			limit, err = strconv.Atoi(s)
+			if err != nil || limit < 1 || limit > maxPageSize {
+				writeError(w, r, newProblem(http.StatusBadRequest, "limit must be between 1 and %d", maxPageSize))
 				return
 			}
-			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal"})
+		}
+		includeDeleted := false
+		if s := q.Get("include_deleted"); s != "" {
+			if includeDeleted, err = strconv.ParseBool(s); err != nil {
+				writeError(w, r, newProblem(http.StatusBadRequest, "include_deleted must be true or false"))
+				return
+			}
+		}
+		page, err := repo.List(r.Context(), ListOptions{
+			Name:           q.Get("name"),
+			Email:          q.Get("email"),
+			Sort:           sort,
+			After:          after,
+			Limit:          limit,
+			IncludeDeleted: includeDeleted,
+		})
+		if err != nil {
+			writeError(w, r, err)
 			return
 		}
+		resp := userListResponse{Users: page.Users, NextCursor: encodeCursor(page.Next)}
+		if resp.Users == nil {
+			resp.Users = []*User{}
+		}
+		writeJSON(w, http.StatusOK, resp)
+	}
+}
+
+func replaceUserHandler(repo UserRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := pathID(r)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		var user User
+		if err := decodeJSON(r, &user); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		// Read, precondition check and write form one unit of work
+		err = withTx(r.Context(), repo, func(repo UserRepository) error {
+			current, err := repo.FindByID(r.Context(), id)
+			if err != nil {
+				return err
+			}
+			if err := checkIfMatch(r, current); err != nil {
+				return err
+			}
+			user.ID = id
+			user.Version = current.Version
+			if err := validate(&user); err != nil {
+				return err
+			}
+			return repo.Update(r.Context(), &user)
+		})
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		w.Header().Set("ETag", userETag(&user))
 		writeJSON(w, http.StatusOK, user)
 	}
 }
 
-func createUserHandler(repo UserRepository) http.HandlerFunc {
+func patchUserHandler(repo UserRepository) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// io.ReadAll is ~2x faster in Go 1.26
-		body, err := io.ReadAll(r.Body)
+		id, err := pathID(r)
 		if err != nil {
-			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "read failed"})
+			writeError(w, r, err)
+			return
+		}
+		var patch userPatch
+		if err := decodeJSON(r, &patch); err != nil {
+			writeError(w, r, err)
 			return
 		}
 		var user User
-		if err := json.Unmarshal(body, &user); err != nil {
-			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+		err = withTx(r.Context(), repo, func(repo UserRepository) error {
+			current, err := repo.FindByID(r.Context(), id)
+			if err != nil {
+				return err
+			}
+			if err := checkIfMatch(r, current); err != nil {
+				return err
+			}
+			user = *current
+			patch.apply(&user)
+			if err := validate(&user); err != nil {
+				return err
+			}
+			return repo.Update(r.Context(), &user)
+		})
+		if err != nil {
+			writeError(w, r, err)
 			return
 		}
-		if err := repo.Save(&user); err != nil {
-			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "save failed"})
+		w.Header().Set("ETag", userETag(&user))
+		writeJSON(w, http.StatusOK, user)
+	}
+}
+
+func deleteUserHandler(repo UserRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := pathID(r)
+		if err != nil {
+			writeError(w, r, err)
 			return
 		}
-		writeJSON(w, http.StatusCreated, user)
+		err = withTx(r.Context(), repo, func(repo UserRepository) error {
+			// If-Match is optional for DELETE; when sent it must match
+			if r.Header.Get("If-Match") != "" {
+				current, err := repo.FindByID(r.Context(), id)
+				if err != nil {
+					return err
+				}
+				if err := checkIfMatch(r, current); err != nil {
+					return err
+				}
+			}
+			return repo.Delete(r.Context(), id)
+		})
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// apiRoutes lists every endpoint of the users API with its documentation
+func apiRoutes(repo UserRepository, cfg *serverConfig) []route {
+	// limitBody caps the body of routes that decode JSON
+	limitBody := func(h http.Handler) http.Handler {
+		return http.MaxBytesHandler(h, cfg.maxBodyBytes)
+	}
+	// bulk gives import and export their own deadline in place of the request timeout
+	bulk := func(h http.Handler) http.Handler {
+		if cfg.bulkTimeout <= 0 {
+			return h
+		}
+		return timeout(cfg.bulkTimeout, nil)(h)
+	}
+	idempotency := idempotent(newIdempotencyStore(cfg.idempotencyTTL))
+
+	// Access rules apply only when an Authenticator is configured
+	az := authorizer{enabled: cfg.authenticator != nil}
+
+	ifMatch := headerParam("If-Match", true, "ETag of the version being modified")
+	writeErrors := []int{
+		http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusPreconditionFailed,
+		http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType,
+		http.StatusUnprocessableEntity, http.StatusPreconditionRequired,
 	}
+
+	var routes []route
+	routes = []route{
+		{"GET /api/users/{id}", az.selfOrAdmin(getUserHandler(repo)), &operation{
+			ID: "getUser", Summary: "Get a user",
+			Params:   []param{headerParam("If-None-Match", false, "ETag held by the client; 304 if unchanged")},
+			Status:   http.StatusOK,
+			Response: User{},
+			Errors:   []int{http.StatusBadRequest, http.StatusNotFound},
+		}},
+		{"PUT /api/users/{id}", az.selfOrAdmin(limitBody(replaceUserHandler(repo))), &operation{
+			ID: "replaceUser", Summary: "Replace a user",
+			Params:   []param{ifMatch},
+			Request:  User{},
+			Status:   http.StatusOK,
+			Response: User{},
+			Errors:   writeErrors,
+		}},
+		{"PATCH /api/users/{id}", az.selfOrAdmin(limitBody(patchUserHandler(repo))), &operation{
+			ID: "patchUser", Summary: "Update some fields of a user",
+			Params:   []param{ifMatch},
+			Request:  userPatch{},
+			Status:   http.StatusOK,
+			Response: User{},
+			Errors:   writeErrors,
+		}},
+		{"DELETE /api/users/{id}", az.selfOrAdmin(deleteUserHandler(repo)), &operation{
+			ID: "deleteUser", Summary: "Delete a user",
+			Params: []param{headerParam("If-Match", false, "ETag of the version being deleted")},
+			Status: http.StatusNoContent,
+			Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusPreconditionFailed},
+		}},
+		{"POST /api/users/{id}/restore", az.admin(restoreUserHandler(repo)), &operation{
+			ID: "restoreUser", Summary: "Undo the deletion of a user",
+			Status:   http.StatusOK,
+			Response: User{},
+			Errors:   []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict},
+		}},
+		{"GET /api/users/{id}/audit", az.admin(userHistoryHandler(repo)), &operation{
+			ID: "getUserAudit", Summary: "List the changes to a user, oldest first",
+			Status:   http.StatusOK,
+			Response: userHistoryResponse{},
+			Errors:   []int{http.StatusBadRequest, http.StatusNotFound},
+		}},
+		{"GET /api/users", az.admin(listUsersHandler(repo)), &operation{
+			ID: "listUsers", Summary: "List users",
+			Params: []param{
+				queryParam("limit", "integer", "page size, 1 to 100 (default 20)"),
+				queryParam("cursor", "string", "next_cursor of the previous page"),
+				queryParam("sort", "string", "id, name or email; prefix with - to sort descending"),
+				queryParam("name", "string", "case-insensitive substring filter"),
+				queryParam("email", "string", "case-insensitive substring filter"),
+				queryParam("include_deleted", "boolean", "also list soft-deleted users"),
+			},
+			Status:   http.StatusOK,
+			Response: userListResponse{},
+			Errors:   []int{http.StatusBadRequest},
+		}},
+		{"POST /api/users:import", az.admin(bulk(http.MaxBytesHandler(importUsersHandler(repo), cfg.maxImportBytes))), &operation{
+			ID: "importUsers", Summary: "Create users from NDJSON or CSV rows (header: name,email; id and version are ignored)",
+			Request:  User{},
+			Consumes: []string{ndjsonContentType, csvContentType},
+			Status:   http.StatusOK,
+			Response: importResult{},
+			Errors:   []int{http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType},
+		}},
+		{"GET /api/users:export", az.admin(bulk(exportUsersHandler(repo))), &operation{
+			ID: "exportUsers", Summary: "Download all users as NDJSON or CSV",
+			Params:   []param{queryParam("format", "string", "ndjson (default) or csv")},
+			Status:   http.StatusOK,
+			Response: User{},
+			Produces: []string{ndjsonContentType, csvContentType},
+			Errors:   []int{http.StatusBadRequest},
+		}},
+		{"POST /api/users", az.admin(limitBody(idempotency(createUserHandler(repo)))), &operation{
+			ID: "createUser", Summary: "Create a user",
+			Params: []param{headerParam(idempotencyKeyHeader, false,
+				"unique key per logical request; retries with the same key replay the first response")},
+			Request:  User{},
+			Status:   http.StatusCreated,
+			Response: User{},
+			Errors: []int{
+				http.StatusBadRequest, http.StatusConflict, http.StatusRequestEntityTooLarge,
+				http.StatusUnsupportedMediaType, http.StatusUnprocessableEntity,
+			},
+		}},
+		// expvar counters such as user_cache, for metrics scrapers
+		{"GET /debug/vars", az.admin(expvar.Handler()), &operation{
+			ID: "getDebugVars", Summary: "Runtime and cache counters published with expvar",
+			Status:   http.StatusOK,
+			Response: map[string]any{},
+		}},
+		// The document describes routes, including this one, so it is built on first use
+		{"GET /openapi.json", openAPIHandler(func() map[string]any { return buildOpenAPI(routes, cfg) }), &operation{
+			ID: "getOpenAPI", Summary: "This OpenAPI document",
+			Status:   http.StatusOK,
+			Response: map[string]any{},
+			Public:   true,
+		}},
+	}
+	return routes
 }
 
-func newServer(repo UserRepository) http.Handler {
+func newServer(repo UserRepository, opts ...ServerOption) http.Handler {
+	cfg := newServerConfig(opts)
+
 	// CrossOriginProtection for CSRF (Go 1.25)
 	protection := http.NewCrossOriginProtection()
 
+	mux := newMux(apiRoutes(repo, cfg), cfg)
+	return chain(protection.Handler(mux), cfg.chain()...)
+}
+
+// newMux registers routes, each behind its per-client rate limit. Nothing
+// else is registered, so every endpoint is in the route table and thus in
+// the OpenAPI document.
+func newMux(routes []route, cfg *serverConfig) *http.ServeMux {
 	mux := http.NewServeMux()
 	// Go 1.22 enhanced routing
-	mux.HandleFunc("GET /api/users/{id}", getUserHandler(repo))
-	mux.HandleFunc("POST /api/users", createUserHandler(repo))
+	for _, rt := range routes {
+		h := rt.handler
+		if limit, ok := cfg.rateLimitFor(rt.pattern); ok {
+			h = rateLimit(newRateLimiter(limit))(h)
+		}
+		mux.Handle(rt.pattern, h)
+	}
+	return mux
+}
+
+// newRepository uses SQLite when DATABASE_PATH is set, in-memory otherwise
+func newRepository(bus *EventBus) (UserRepository, func() error, error) {
+	path := os.Getenv("DATABASE_PATH")
+	if path == "" {
+		return NewPublishingUserRepository(NewInMemoryUserRepository(), bus), func() error { return nil }, nil
+	}
+	db, err := OpenSQLite(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	repo, err := NewSQLUserRepository(db)
+	if err != nil {
+		_ = db.Close()
+		return nil, nil, err
+	}
+	logger.Info("using sqlite repository", slog.String("path", path))
 
-	return protection.Handler(mux)
+	ctx, stopRelay := context.WithCancel(context.Background())
+	go NewOutboxRelay(db, bus, time.Second).Run(ctx)
+	closeRepo := func() error {
+		stopRelay()
+		return db.Close()
+	}
+	cache := NewCachingUserRepository(repo, 10_000, time.Minute)
+	cache.Publish()
+	return cache, closeRepo, nil
+}
+
+// logEvent is the default subscriber: it records every user change
+func logEvent(ctx context.Context, e Event) error {
+	logger.InfoContext(ctx, "user event", slog.String("type", string(e.Type)), slog.Int("user_id", e.UserID))
+	return nil
+}
+
+// newAuthenticator uses AUTH_SECRET to sign tokens; nil disables auth
+func newAuthenticator() (*HMACTokenAuthenticator, error) {
+	secret := os.Getenv("AUTH_SECRET")
+	if secret == "" {
+		return nil, nil
+	}
+	return NewHMACTokenAuthenticator([]byte(secret))
+}
+
+// runTokenCommand implements `go run . token -sub 1 [-admin] [-ttl 1h]`
+func runTokenCommand(args []string) error {
+	fs := flag.NewFlagSet("token", flag.ContinueOnError)
+	sub := fs.Int("sub", 0, "user ID the token is issued for")
+	admin := fs.Bool("admin", false, "grant the admin role")
+	ttl := fs.Duration("ttl", time.Hour, "token lifetime")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	auth, err := newAuthenticator()
+	if err != nil {
+		return err
+	}
+	if auth == nil {
+		return errors.New("AUTH_SECRET is not set")
+	}
+	p := Principal{UserID: *sub}
+	if *admin {
+		p.Roles = []string{roleAdmin}
+	}
+	token, err := auth.Issue(p, *ttl)
+	if err != nil {
+		return err
+	}
+	fmt.Println(token)
+	return nil
 }
 
 func main() {
-	repo := NewInMemoryUserRepository()
-	handler := newServer(repo)
+	if len(os.Args) > 1 && os.Args[1] == "token" {
+		if err := runTokenCommand(os.Args[2:]); err != nil {
+			fmt.Println("token error:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	bus := NewEventBus()
+	bus.Subscribe(SubscriberFunc(logEvent))
+	repo, closeRepo, err := newRepository(bus)
+	if err != nil {
+		fmt.Println("repository error:", err)
+		os.Exit(1)
+	}
+	defer closeRepo()
+
+	var opts []ServerOption
+	auth, err := newAuthenticator()
+	if err != nil {
+		fmt.Println("auth error:", err)
+		os.Exit(1)
+	}
+	if auth != nil {
+		opts = append(opts, WithAuthenticator(auth))
+	} else {
+		logger.Warn("AUTH_SECRET not set; authentication is disabled")
+	}
+
+	opts = append(opts,
+		WithDefaultRateLimit(RateLimit{Rate: 10, Burst: 20}),
+		WithRateLimit("POST /api/users", RateLimit{Rate: 1, Burst: 5}),
+	)
+
+	handler := newServer(repo, opts...)
 	logger.Info("server starting", slog.String("addr", ":8080"))
 	if err := http.ListenAndServe(":8080", handler); err != nil {
 		fmt.Println("server error:", err)
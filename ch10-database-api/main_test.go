@@ -0,0 +1,279 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// Keep access logs out of test output
+	logger = slog.New(slog.DiscardHandler)
+	os.Exit(m.Run())
+}
+
+// doRequest serves one request; header holds optional key/value pairs
+func doRequest(t *testing.T, h http.Handler, method, target, body string, header ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func decodeBody[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	t.Helper()
+	var v T
+	if err := json.Unmarshal(rec.Body.Bytes(), &v); err != nil {
+		t.Fatalf("decode %q: %v", rec.Body.String(), err)
+	}
+	return v
+}
+
+func TestUserCRUD(t *testing.T) {
+	h := newServer(NewInMemoryUserRepository())
+
+	rec := doRequest(t, h, http.MethodPost, "/api/users", `{"name":"Alice","email":"alice@example.com"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: status = %d, body = %s", rec.Code, rec.Body)
+	}
+	created := decodeBody[User](t, rec)
+
+	rec = doRequest(t, h, http.MethodPut, "/api/users/1", `{"name":"Alice Smith","email":"alice@example.com"}`,
+		"If-Match", rec.Header().Get("ETag"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("put: status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	rec = doRequest(t, h, http.MethodPatch, "/api/users/1", `{"email":"smith@example.com"}`,
+		"If-Match", rec.Header().Get("ETag"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("patch: status = %d, body = %s", rec.Code, rec.Body)
+	}
+	patched := decodeBody[User](t, rec)
+	if patched.ID != created.ID || patched.Name != "Alice Smith" || patched.Email != "smith@example.com" || patched.Version != 3 {
+		t.Errorf("patch result = %+v", patched)
+	}
+
+	if rec = doRequest(t, h, http.MethodDelete, "/api/users/1", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete: status = %d", rec.Code)
+	}
+	if rec = doRequest(t, h, http.MethodGet, "/api/users/1", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("get after delete: status = %d", rec.Code)
+	}
+	if rec = doRequest(t, h, http.MethodDelete, "/api/users/1", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("second delete: status = %d", rec.Code)
+	}
+}
+
+func TestListUsersPagination(t *testing.T) {
+	repos := map[string]UserRepository{
+		"memory": NewInMemoryUserRepository(),
+		"sql":    newTestSQLRepository(t),
+	}
+	for name, repo := range repos {
+		t.Run(name, func(t *testing.T) {
+			for _, n := range []string{"dave", "carol", "bob", "alice", "erin"} {
+				if err := repo.Save(t.Context(), &User{Name: n, Email: n + "@example.com"}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			h := newServer(repo)
+
+			var names []string
+			q := url.Values{"sort": {"-name"}, "limit": {"2"}}
+			for pages := 0; ; pages++ {
+				if pages > 5 {
+					t.Fatal("pagination did not terminate")
+				}
+				rec := doRequest(t, h, http.MethodGet, "/api/users?"+q.Encode(), "")
+				if rec.Code != http.StatusOK {
+					t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+				}
+				resp := decodeBody[userListResponse](t, rec)
+				for _, u := range resp.Users {
+					names = append(names, u.Name)
+				}
+				if resp.NextCursor == "" {
+					break
+				}
+				q.Set("cursor", resp.NextCursor)
+			}
+			if got, want := strings.Join(names, ","), "erin,dave,carol,bob,alice"; got != want {
+				t.Errorf("names = %s, want %s", got, want)
+			}
+
+			rec := doRequest(t, h, http.MethodGet, "/api/users?name=AR", "")
+			resp := decodeBody[userListResponse](t, rec)
+			if len(resp.Users) != 1 || resp.Users[0].Name != "carol" {
+				t.Errorf("name filter = %+v", resp.Users)
+			}
+
+			// A cursor is only valid for the sort order it was issued for
+			q.Set("sort", "email")
+			if rec := doRequest(t, h, http.MethodGet, "/api/users?"+q.Encode(), ""); rec.Code != http.StatusBadRequest {
+				t.Errorf("mismatched cursor: status = %d", rec.Code)
+			}
+		})
+	}
+}
+
+// TestInMemoryUserRepositoryConcurrent is meant to be run with -race
+func TestInMemoryUserRepositoryConcurrent(t *testing.T) {
+	repo := NewInMemoryUserRepository()
+	h := newServer(repo)
+
+	const workers, iterations = 16, 50
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Go(func() {
+			for i := range iterations {
+				name := fmt.Sprintf("user-%d-%d", w, i)
+				u := &User{Name: name, Email: name + "@example.com"}
+				if err := repo.Save(t.Context(), u); err != nil {
+					t.Error(err)
+					return
+				}
+				got, err := repo.FindByID(t.Context(), u.ID)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				// Mutating a returned copy must not race with other readers
+				got.Name = "changed"
+				if err := repo.Update(t.Context(), got); err != nil && !errors.Is(err, ErrVersionMismatch) {
+					t.Error(err)
+					return
+				}
+				if _, err := repo.List(t.Context(), ListOptions{Name: "changed", Limit: 10}); err != nil {
+					t.Error(err)
+					return
+				}
+				doRequest(t, h, http.MethodGet, fmt.Sprintf("/api/users/%d", u.ID), "")
+			}
+		})
+	}
+	wg.Wait()
+
+	page, err := repo.List(t.Context(), ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Users) != workers*iterations {
+		t.Errorf("got %d users, want %d", len(page.Users), workers*iterations)
+	}
+	seen := make(map[int]bool)
+	for _, u := range page.Users {
+		if seen[u.ID] {
+			t.Errorf("duplicate ID %d", u.ID)
+		}
+		seen[u.ID] = true
+	}
+}
+
+func TestConditionalRequests(t *testing.T) {
+	repos := map[string]UserRepository{
+		"memory": NewInMemoryUserRepository(),
+		"sql":    newTestSQLRepository(t),
+	}
+	for name, repo := range repos {
+		t.Run(name, func(t *testing.T) {
+			h := newServer(repo)
+			rec := doRequest(t, h, http.MethodPost, "/api/users", `{"name":"Alice","email":"alice@example.com"}`)
+			etag := rec.Header().Get("ETag")
+			if etag == "" {
+				t.Fatal("create: missing ETag")
+			}
+
+			if rec := doRequest(t, h, http.MethodGet, "/api/users/1", "", "If-None-Match", etag); rec.Code != http.StatusNotModified {
+				t.Errorf("conditional GET: status = %d, want 304", rec.Code)
+			}
+
+			body := `{"name":"Alice B","email":"alice@example.com"}`
+			if rec := doRequest(t, h, http.MethodPut, "/api/users/1", body); rec.Code != http.StatusPreconditionRequired {
+				t.Errorf("PUT without If-Match: status = %d, want 428", rec.Code)
+			}
+			rec = doRequest(t, h, http.MethodPut, "/api/users/1", body, "If-Match", etag)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("PUT: status = %d, body = %s", rec.Code, rec.Body)
+			}
+			if rec.Header().Get("ETag") == etag {
+				t.Error("ETag did not change after update")
+			}
+
+			// A second writer holding the old ETag loses
+			if rec := doRequest(t, h, http.MethodPatch, "/api/users/1", `{"name":"Mallory"}`, "If-Match", etag); rec.Code != http.StatusPreconditionFailed {
+				t.Errorf("stale PATCH: status = %d, want 412", rec.Code)
+			}
+			if rec := doRequest(t, h, http.MethodGet, "/api/users/1", "", "If-None-Match", etag); rec.Code != http.StatusOK {
+				t.Errorf("GET with stale If-None-Match: status = %d, want 200", rec.Code)
+			}
+
+			// The repository itself rejects stale versions
+			stale := &User{ID: 1, Name: "x", Email: "x@example.com", Version: 1}
+			if err := repo.Update(t.Context(), stale); !errors.Is(err, ErrVersionMismatch) {
+				t.Errorf("Update with stale version: err = %v", err)
+			}
+		})
+	}
+}
+
+func TestUniqueEmail(t *testing.T) {
+	repos := map[string]UserRepository{
+		"memory": NewInMemoryUserRepository(),
+		"sql":    newTestSQLRepository(t),
+	}
+	for name, repo := range repos {
+		t.Run(name, func(t *testing.T) {
+			alice := &User{Name: "Alice", Email: "alice@example.com"}
+			bob := &User{Name: "Bob", Email: "bob@example.com"}
+			for _, u := range []*User{alice, bob} {
+				if err := repo.Save(t.Context(), u); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := repo.Save(t.Context(), &User{Name: "Imposter", Email: "ALICE@example.com"}); !errors.Is(err, ErrConflict) {
+				t.Errorf("Save duplicate: err = %v, want ErrConflict", err)
+			}
+			taken := *bob
+			taken.Email = "Alice@Example.com"
+			if err := repo.Update(t.Context(), &taken); !errors.Is(err, ErrConflict) {
+				t.Errorf("Update to taken email: err = %v, want ErrConflict", err)
+			}
+			// Changing the case of one's own email is not a conflict
+			own := *alice
+			own.Email = "Alice@example.com"
+			if err := repo.Update(t.Context(), &own); err != nil {
+				t.Errorf("Update own email: %v", err)
+			}
+			// Deleting frees the address
+			if err := repo.Delete(t.Context(), bob.ID); err != nil {
+				t.Fatal(err)
+			}
+			if err := repo.Save(t.Context(), &User{Name: "Bob 2", Email: "bob@example.com"}); err != nil {
+				t.Errorf("Save after delete: %v", err)
+			}
+
+			h := newServer(repo)
+			rec := doRequest(t, h, http.MethodPost, "/api/users", `{"name":"Again","email":"alice@EXAMPLE.com"}`)
+			if rec.Code != http.StatusConflict {
+				t.Errorf("POST duplicate: status = %d, want 409", rec.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRequestID(t *testing.T) {
+	h := newServer(NewInMemoryUserRepository())
+
+	rec := doRequest(t, h, http.MethodGet, "/api/users/1", "", "X-Request-ID", "abc-123")
+	if got := rec.Header().Get(requestIDHeader); got != "abc-123" {
+		t.Errorf("propagated ID = %q, want abc-123", got)
+	}
+	rec = doRequest(t, h, http.MethodGet, "/api/users/1", "", "X-Request-ID", "bad id\n")
+	if got := rec.Header().Get(requestIDHeader); got == "" || got == "bad id\n" {
+		t.Errorf("generated ID = %q", got)
+	}
+}
+
+func TestRecoverer(t *testing.T) {
+	boom := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/boom" {
+				panic("boom")
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+	h := newServer(NewInMemoryUserRepository(), WithMiddleware(boom))
+
+	rec := doRequest(t, h, http.MethodGet, "/boom", "")
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500", rec.Code)
+	}
+	if p := decodeBody[Problem](t, rec); p.Detail != "" {
+		t.Errorf("panic value leaked to client: %q", p.Detail)
+	}
+	// The server keeps serving after a panic
+	if rec := doRequest(t, h, http.MethodGet, "/api/users/1", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("status after panic = %d, want 404", rec.Code)
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	var deadline time.Time
+	probe := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			deadline, _ = r.Context().Deadline()
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	doRequest(t, newServer(NewInMemoryUserRepository(), WithRequestTimeout(time.Second), WithMiddleware(probe)),
+		http.MethodGet, "/api/users/1", "")
+	if deadline.IsZero() || time.Until(deadline) > time.Second {
+		t.Errorf("deadline = %v, want within 1s", deadline)
+	}
+
+	deadline = time.Time{}
+	doRequest(t, newServer(NewInMemoryUserRepository(), WithRequestTimeout(0), WithMiddleware(probe)),
+		http.MethodGet, "/api/users/1", "")
+	if !deadline.IsZero() {
+		t.Errorf("deadline = %v, want none when disabled", deadline)
+	}
+}
+
+func TestCompression(t *testing.T) {
+	repo := NewInMemoryUserRepository()
+	if err := repo.Save(t.Context(), &User{Name: "Alice", Email: "alice@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	h := newServer(repo)
+
+	rec := doRequest(t, h, http.MethodGet, "/api/users/1", "", "Accept-Encoding", "gzip, deflate")
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", rec.Header().Get("Content-Encoding"))
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var u User
+	if err := json.NewDecoder(zr).Decode(&u); err != nil {
+		t.Fatal(err)
+	}
+	if u.Name != "Alice" {
+		t.Errorf("decoded user = %+v", u)
+	}
+
+	// The gzip representation has its own strong ETag
+	gzipETag := rec.Header().Get("ETag")
+	if want := `"1-gzip"`; gzipETag != want {
+		t.Errorf("gzip ETag = %s, want %s", gzipETag, want)
+	}
+
+	// 304 has no body and must not be encoded
+	rec = doRequest(t, h, http.MethodGet, "/api/users/1", "", "Accept-Encoding", "gzip", "If-None-Match", gzipETag)
+	if rec.Code != http.StatusNotModified || rec.Header().Get("Content-Encoding") != "" || rec.Body.Len() != 0 {
+		t.Errorf("304: status = %d, encoding = %q, body = %d bytes", rec.Code, rec.Header().Get("Content-Encoding"), rec.Body.Len())
+	}
+	if rec.Header().Get("ETag") != gzipETag {
+		t.Errorf("304 ETag = %s, want %s", rec.Header().Get("ETag"), gzipETag)
+	}
+
+	// Clients that don't ask for gzip get plain JSON
+	rec = doRequest(t, h, http.MethodGet, "/api/users/1", "")
+	if rec.Header().Get("Content-Encoding") != "" {
+		t.Error("response compressed without Accept-Encoding")
+	}
+	if rec.Header().Get("ETag") != userETag(&u) {
+		t.Errorf("identity ETag = %s, want %s", rec.Header().Get("ETag"), userETag(&u))
+	}
+
+	// Either tag identifies the version for a conditional update
+	rec = doRequest(t, h, http.MethodPatch, "/api/users/1", `{"name":"Alice B."}`, "If-Match", gzipETag, "Accept-Encoding", "gzip")
+	if rec.Code != http.StatusOK || rec.Header().Get("ETag") != `"2-gzip"` {
+		t.Errorf("PATCH with gzip ETag: status = %d, ETag = %s", rec.Code, rec.Header().Get("ETag"))
+	}
+	if rec = doRequest(t, newServer(repo, WithCompression(false)), http.MethodGet, "/api/users/1", "", "Accept-Encoding", "gzip"); rec.Header().Get("Content-Encoding") != "" {
+		t.Error("response compressed with compression disabled")
+	}
+}
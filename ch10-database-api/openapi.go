@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// route is an API endpoint together with its OpenAPI documentation
+type route struct {
+	pattern string // ServeMux pattern, e.g. "GET /api/users/{id}"
+	handler http.Handler
+	doc     *operation
+}
+
+// operation documents a route; body types are described by example values
+type operation struct {
+	ID       string
+	Summary  string
+	Params   []param // query and header parameters; path parameters are derived
+	Request  any     // decoded request body, nil if none
+	Status   int     // success status
+	Response any     // success body, nil if none
+	Errors   []int   // route-specific error statuses
+	Public   bool    // served without authentication
+
+	// Media types of streamed bodies, whose schema describes one record;
+	// empty means application/json
+	Consumes []string
+	Produces []string
+}
+
+type param struct {
+	Name        string `json:"name"`
+	In          string `json:"in"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+	Schema      any    `json:"schema"`
+}
+
+func queryParam(name, typ, description string) param {
+	return param{Name: name, In: "query", Description: description, Schema: map[string]any{"type": typ}}
+}
+
+func headerParam(name string, required bool, description string) param {
+	return param{Name: name, In: "header", Description: description, Required: required, Schema: map[string]any{"type": "string"}}
+}
+
+// buildOpenAPI derives an OpenAPI 3.1 document from the registered routes
+func buildOpenAPI(routes []route, cfg *serverConfig) map[string]any {
+	g := &schemaGen{components: make(map[string]any)}
+	problem := g.schema(reflect.TypeFor[Problem]())
+
+	paths := make(map[string]map[string]any)
+	for _, rt := range routes {
+		method, path, _ := strings.Cut(rt.pattern, " ")
+		op := rt.doc
+
+		params := []param{}
+		for _, name := range pathParams(path) {
+			params = append(params, param{Name: name, In: "path", Required: true, Schema: map[string]any{"type": "integer"}})
+		}
+		params = append(params, op.Params...)
+
+		success := map[string]any{"description": http.StatusText(op.Status)}
+		if op.Response != nil {
+			success["content"] = bodyContent(op.Produces, g.schema(reflect.TypeOf(op.Response)))
+		}
+		responses := map[string]any{strconv.Itoa(op.Status): success}
+
+		errs := slices.Clone(op.Errors)
+		if cfg.authenticator != nil && !op.Public {
+			errs = append(errs, http.StatusUnauthorized, http.StatusForbidden)
+		}
+		if _, limited := cfg.rateLimitFor(rt.pattern); limited {
+			errs = append(errs, http.StatusTooManyRequests)
+		}
+		errs = append(errs, http.StatusInternalServerError)
+		for _, status := range errs {
+			responses[strconv.Itoa(status)] = map[string]any{
+				"description": http.StatusText(status),
+				"content":     jsonContent(problemContentType, problem),
+			}
+		}
+
+		o := map[string]any{
+			"operationId": op.ID,
+			"summary":     op.Summary,
+			"parameters":  params,
+			"responses":   responses,
+		}
+		if op.Public && cfg.authenticator != nil {
+			o["security"] = []any{} // overrides the document-wide bearerAuth
+		}
+		if op.Request != nil {
+			o["requestBody"] = map[string]any{
+				"required": true,
+				"content":  bodyContent(op.Consumes, g.schema(reflect.TypeOf(op.Request))),
+			}
+		}
+		if paths[path] == nil {
+			paths[path] = make(map[string]any)
+		}
+		paths[path][strings.ToLower(method)] = o
+	}
+
+	components := map[string]any{"schemas": g.components}
+	doc := map[string]any{
+		"openapi": "3.1.0",
+		"info":    map[string]any{"title": "Users API", "version": "1.0.0"},
+		"paths":   paths,
+	}
+	if cfg.authenticator != nil {
+		components["securitySchemes"] = map[string]any{
+			"bearerAuth": map[string]any{"type": "http", "scheme": "bearer"},
+		}
+		doc["security"] = []any{map[string]any{"bearerAuth": []string{}}}
+	}
+	doc["components"] = components
+	return doc
+}
+
+// pathParams returns the {wildcard} names of a ServeMux path
+func pathParams(path string) []string {
+	var names []string
+	for seg := range strings.SplitSeq(path, "/") {
+		if name, ok := strings.CutPrefix(seg, "{"); ok {
+			names = append(names, strings.TrimSuffix(strings.TrimSuffix(name, "}"), "..."))
+		}
+	}
+	return names
+}
+
+func jsonContent(mediaType string, schema any) map[string]any {
+	return map[string]any{mediaType: map[string]any{"schema": schema}}
+}
+
+// bodyContent is the content map of a request or response body
+func bodyContent(mediaTypes []string, schema any) map[string]any {
+	if len(mediaTypes) == 0 {
+		return jsonContent("application/json", schema)
+	}
+	content := make(map[string]any)
+	for _, mt := range mediaTypes {
+		content[mt] = map[string]any{"schema": schema}
+	}
+	return content
+}
+
+// schemaGen converts Go types to JSON Schema using their json and validate
+// tags; named structs are collected under components/schemas
+type schemaGen struct {
+	components map[string]any
+}
+
+func (g *schemaGen) schema(t reflect.Type) map[string]any {
+	if t == reflect.TypeFor[time.Time]() {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		if t.Elem().Kind() == reflect.Struct {
+			return g.schema(t.Elem())
+		}
+		return map[string]any{"anyOf": []any{g.schema(t.Elem()), map[string]any{"type": "null"}}}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		name := schemaName(t)
+		if _, done := g.components[name]; !done {
+			g.components[name] = nil // guards against recursive types
+			g.components[name] = g.object(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]any{}
+}
+
+func (g *schemaGen) object(t reflect.Type) map[string]any {
+	props := make(map[string]any)
+	required := []string{}
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() || f.Tag.Get("json") == "-" {
+			continue
+		}
+		name := jsonName(f)
+		s := g.schema(f.Type)
+		for spec := range strings.SplitSeq(f.Tag.Get("validate"), ",") {
+			rule, arg, _ := strings.Cut(spec, "=")
+			switch rule {
+			case "required":
+				required = append(required, name)
+			case "email":
+				s["format"] = "email"
+			case "min":
+				n, _ := strconv.Atoi(arg)
+				s["minLength"] = n
+			case "max":
+				n, _ := strconv.Atoi(arg)
+				s["maxLength"] = n
+			}
+		}
+		props[name] = s
+	}
+	obj := map[string]any{"type": "object", "properties": props}
+	if len(required) > 0 {
+		obj["required"] = required
+	}
+	return obj
+}
+
+// schemaName exports unexported type names: userPatch -> UserPatch
+func schemaName(t reflect.Type) string {
+	r := []rune(t.Name())
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
+
+// openAPIHandler serves the document returned by build, which is called and
+// encoded once, on the first request
+func openAPIHandler(build func() map[string]any) http.HandlerFunc {
+	body := sync.OnceValue(func() []byte {
+		b, err := json.MarshalIndent(build(), "", "  ")
+		if err != nil {
+			panic("openapi: " + err.Error())
+		}
+		return b
+	})
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body())
+	}
+}
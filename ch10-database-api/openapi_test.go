@@ -0,0 +1,104 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestRoutesAreDocumented fails when a route is added without its schema
+func TestRoutesAreDocumented(t *testing.T) {
+	// Action endpoints that take no request body
+	bodyless := map[string]bool{"POST /api/users/{id}/restore": true}
+	cfg := newServerConfig(nil)
+	routes := apiRoutes(NewInMemoryUserRepository(), cfg)
+	mux := newMux(routes, cfg) // what newServer serves
+	for _, rt := range routes {
+		t.Run(rt.pattern, func(t *testing.T) {
+			method, path, _ := strings.Cut(rt.pattern, " ")
+			r := httptest.NewRequest(method, strings.NewReplacer("{id}", "1").Replace(path), nil)
+			if _, pattern := mux.Handler(r); pattern != rt.pattern {
+				t.Errorf("served by %q", pattern)
+			}
+
+			op := rt.doc
+			if op == nil {
+				t.Fatal("route has no documentation")
+			}
+			if op.ID == "" || op.Summary == "" || op.Status == 0 {
+				t.Errorf("incomplete operation: %+v", op)
+			}
+			if op.Response == nil && op.Status != http.StatusNoContent {
+				t.Error("missing response schema")
+			}
+			if method == http.MethodPost || method == http.MethodPut || method == http.MethodPatch {
+				if op.Request == nil && !bodyless[rt.pattern] {
+					t.Error("missing request body schema")
+				}
+			}
+		})
+	}
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	h := newServer(NewInMemoryUserRepository(), WithAuthenticator(newTestAuthenticator(t)))
+	rec := doRequest(t, h, http.MethodGet, "/openapi.json", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	doc := decodeBody[map[string]any](t, rec)
+	if doc["openapi"] != "3.1.0" {
+		t.Errorf("openapi = %v", doc["openapi"])
+	}
+
+	paths := doc["paths"].(map[string]any)
+	for _, rt := range apiRoutes(NewInMemoryUserRepository(), newServerConfig(nil)) {
+		method, path, _ := strings.Cut(rt.pattern, " ")
+		item, _ := paths[path].(map[string]any)
+		if _, ok := item[strings.ToLower(method)]; !ok {
+			t.Errorf("%s missing from paths", rt.pattern)
+		}
+	}
+
+	// The document is public; the debug counters are not
+	if sec, ok := paths["/openapi.json"].(map[string]any)["get"].(map[string]any)["security"].([]any); !ok || len(sec) != 0 {
+		t.Errorf("GET /openapi.json security = %v, want []", sec)
+	}
+	if _, ok := paths["/debug/vars"].(map[string]any)["get"].(map[string]any)["responses"].(map[string]any)["401"]; !ok {
+		t.Error("GET /debug/vars does not document 401")
+	}
+
+	schemas := doc["components"].(map[string]any)["schemas"].(map[string]any)
+	user := schemas["User"].(map[string]any)
+	props := user["properties"].(map[string]any)
+	for _, name := range []string{"id", "name", "email", "version"} {
+		if _, ok := props[name]; !ok {
+			t.Errorf("User schema lacks %q", name)
+		}
+	}
+	if f := props["email"].(map[string]any)["format"]; f != "email" {
+		t.Errorf("email format = %v", f)
+	}
+
+	// Every $ref must resolve to a component
+	var walk func(v any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			if ref, ok := v["$ref"].(string); ok {
+				if _, ok := schemas[strings.TrimPrefix(ref, "#/components/schemas/")]; !ok {
+					t.Errorf("dangling $ref %s", ref)
+				}
+			}
+			for _, e := range v {
+				walk(e)
+			}
+		case []any:
+			for _, e := range v {
+				walk(e)
+			}
+		}
+	}
+	walk(doc)
+}
@@ -0,0 +1,133 @@
+package main
+
+import "time"
+
+// serverConfig holds the tunables of newServer
+type serverConfig struct {
+	maxBodyBytes   int64
+	maxImportBytes int64
+	requestTimeout time.Duration
+	bulkTimeout    time.Duration
+	compression    bool
+	authenticator  Authenticator
+	rateLimits     map[string]RateLimit // by route pattern
+	defaultLimit   RateLimit
+	idempotencyTTL time.Duration
+	middleware     []Middleware
+}
+
+// ServerOption configures newServer (Functional Options pattern)
+type ServerOption func(*serverConfig)
+
+// WithMaxBodyBytes caps request bodies; larger requests get 413
+func WithMaxBodyBytes(n int64) ServerOption {
+	return func(c *serverConfig) {
+		c.maxBodyBytes = n
+	}
+}
+
+// WithMaxImportBytes caps the body of a bulk import
+func WithMaxImportBytes(n int64) ServerOption {
+	return func(c *serverConfig) {
+		c.maxImportBytes = n
+	}
+}
+
+// WithRequestTimeout sets the request context deadline; 0 disables it
+func WithRequestTimeout(d time.Duration) ServerOption {
+	return func(c *serverConfig) {
+		c.requestTimeout = d
+	}
+}
+
+// WithBulkTimeout sets the deadline of bulk import and export, which
+// replaces WithRequestTimeout for them; 0 disables it
+func WithBulkTimeout(d time.Duration) ServerOption {
+	return func(c *serverConfig) {
+		c.bulkTimeout = d
+	}
+}
+
+// WithCompression toggles gzip response compression
+func WithCompression(enabled bool) ServerOption {
+	return func(c *serverConfig) {
+		c.compression = enabled
+	}
+}
+
+// WithAuthenticator enables authentication and per-user authorization.
+// Without it the API is open, which is only meant for local development.
+func WithAuthenticator(a Authenticator) ServerOption {
+	return func(c *serverConfig) {
+		c.authenticator = a
+	}
+}
+
+// WithRateLimit limits one route, identified by its mux pattern
+// (e.g. "POST /api/users"), per client
+func WithRateLimit(pattern string, limit RateLimit) ServerOption {
+	return func(c *serverConfig) {
+		c.rateLimits[pattern] = limit
+	}
+}
+
+// WithDefaultRateLimit limits every route without its own WithRateLimit
+func WithDefaultRateLimit(limit RateLimit) ServerOption {
+	return func(c *serverConfig) {
+		c.defaultLimit = limit
+	}
+}
+
+// WithIdempotencyTTL sets how long POST responses are kept for replay
+func WithIdempotencyTTL(d time.Duration) ServerOption {
+	return func(c *serverConfig) {
+		c.idempotencyTTL = d
+	}
+}
+
+// WithMiddleware appends middleware inside the built-in chain, closest to the routes
+func WithMiddleware(mws ...Middleware) ServerOption {
+	return func(c *serverConfig) {
+		c.middleware = append(c.middleware, mws...)
+	}
+}
+
+func newServerConfig(opts []ServerOption) *serverConfig {
+	cfg := &serverConfig{
+		maxBodyBytes:   1 << 20, // 1 MiB
+		maxImportBytes: 32 << 20,
+		requestTimeout: 30 * time.Second,
+		bulkTimeout:    10 * time.Minute,
+		compression:    true,
+		rateLimits:     make(map[string]RateLimit),
+		idempotencyTTL: 24 * time.Hour,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// rateLimitFor returns the limit for a route; ok is false if it is unlimited
+func (c *serverConfig) rateLimitFor(pattern string) (limit RateLimit, ok bool) {
+	limit, found := c.rateLimits[pattern]
+	if !found {
+		limit = c.defaultLimit
+	}
+	return limit, limit.Rate > 0 && limit.Burst > 0
+}
+
+// chain returns the middleware newServer wraps around its routes, outermost first
+func (c *serverConfig) chain() []Middleware {
+	mws := []Middleware{requestID, accessLog, recoverer}
+	if c.authenticator != nil {
+		mws = append(mws, authenticate(c.authenticator))
+	}
+	if c.requestTimeout > 0 {
+		mws = append(mws, timeout(c.requestTimeout, isBulkRequest))
+	}
+	if c.compression {
+		mws = append(mws, compress)
+	}
+	return append(mws, c.middleware...)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// recordEvent appends e to the outbox and the user's history; r must be
+// inside a transaction
+func (r *SQLUserRepository) recordEvent(ctx context.Context, e Event) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("record %s: %w", e.Type, err)
+	}
+	if _, err := r.q.ExecContext(ctx, `INSERT INTO outbox (payload) VALUES (?)`, payload); err != nil {
+		return fmt.Errorf("record %s: %w", e.Type, err)
+	}
+	if _, err := r.q.ExecContext(ctx, `INSERT INTO user_history (user_id, payload) VALUES (?, ?)`, e.UserID, payload); err != nil {
+		return fmt.Errorf("record %s: %w", e.Type, err)
+	}
+	return nil
+}
+
+// OutboxRelay delivers outbox events to a bus in commit order and removes
+// them once every subscriber has accepted them. A failed event is retried
+// on the next poll, so delivery is at least once. Run one relay per database.
+type OutboxRelay struct {
+	db       *sql.DB
+	bus      *EventBus
+	interval time.Duration
+	batch    int
+}
+
+func NewOutboxRelay(db *sql.DB, bus *EventBus, interval time.Duration) *OutboxRelay {
+	return &OutboxRelay{db: db, bus: bus, interval: interval, batch: 100}
+}
+
+// Run polls the outbox until ctx is done
+func (o *OutboxRelay) Run(ctx context.Context) {
+	t := time.NewTicker(o.interval)
+	defer t.Stop()
+	for {
+		if _, err := o.RelayOnce(ctx); err != nil && ctx.Err() == nil {
+			logger.Error("outbox relay failed", slog.Any("err", err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// RelayOnce delivers up to one batch of pending events and returns how many
+// were delivered. It stops at the first failure to preserve ordering.
+func (o *OutboxRelay) RelayOnce(ctx context.Context) (int, error) {
+	type row struct {
+		id    int64
+		event Event
+	}
+	rows, err := o.db.QueryContext(ctx, `SELECT id, payload FROM outbox ORDER BY id LIMIT ?`, o.batch)
+	if err != nil {
+		return 0, fmt.Errorf("read outbox: %w", err)
+	}
+	var pending []row
+	for rows.Next() {
+		var r row
+		var payload []byte
+		if err := rows.Scan(&r.id, &payload); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("read outbox: %w", err)
+		}
+		if err := json.Unmarshal(payload, &r.event); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("outbox event %d: %w", r.id, err)
+		}
+		pending = append(pending, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("read outbox: %w", err)
+	}
+
+	for i, r := range pending {
+		if err := o.bus.Publish(ctx, r.event); err != nil {
+			return i, fmt.Errorf("outbox event %d: %w", r.id, err)
+		}
+		if _, err := o.db.ExecContext(ctx, `DELETE FROM outbox WHERE id = ?`, r.id); err != nil {
+			return i, fmt.Errorf("outbox event %d: %w", r.id, err)
+		}
+	}
+	return len(pending), nil
+}
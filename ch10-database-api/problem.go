@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+)
+
+// Problem is an RFC 9457 problem details object. It implements error so
+// handlers can return a specific problem through the same path as domain errors.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+
+	// Errors is an extension member listing invalid fields
+	Errors []*FieldError `json:"errors,omitempty"`
+}
+
+func (p *Problem) Error() string {
+	if p.Detail == "" {
+		return p.Title
+	}
+	return p.Title + ": " + p.Detail
+}
+
+const (
+	problemContentType = "application/problem+json"
+
+	// "about:blank" means the HTTP status code is the whole story (RFC 9457 4.2.1)
+	problemTypeBlank      = "about:blank"
+	problemTypeValidation = "/problems/validation-error"
+)
+
+// newProblem returns an about:blank problem titled after the status code
+func newProblem(status int, format string, args ...any) *Problem {
+	return &Problem{
+		Type:   problemTypeBlank,
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: fmt.Sprintf(format, args...),
+	}
+}
+
+// invalidJSON reports a request body that could not be decoded
+func invalidJSON(err error) *Problem {
+	return newProblem(http.StatusBadRequest, "invalid JSON body: %v", err)
+}
+
+// problemFor maps domain errors onto problem details
+func problemFor(err error) *Problem {
+	if p, ok := errors.AsType[*Problem](err); ok {
+		cp := *p
+		return &cp
+	}
+	if fields := fieldErrors(err); len(fields) > 0 {
+		return &Problem{
+			Type:   problemTypeValidation,
+			Title:  "Validation Failed",
+			Status: http.StatusUnprocessableEntity,
+			Detail: fmt.Sprintf("%d field(s) failed validation", len(fields)),
+			Errors: fields,
+		}
+	}
+	if errors.Is(err, ErrNotFound) {
+		return newProblem(http.StatusNotFound, "%v", err)
+	}
+	if errors.Is(err, ErrUnauthenticated) {
+		return newProblem(http.StatusUnauthorized, "%v", err)
+	}
+	if errors.Is(err, ErrForbidden) {
+		return newProblem(http.StatusForbidden, "%v", err)
+	}
+	if errors.Is(err, ErrConflict) {
+		return newProblem(http.StatusConflict, "%v", err)
+	}
+	if errors.Is(err, ErrVersionMismatch) {
+		return newProblem(http.StatusPreconditionFailed, "%v", err)
+	}
+	if errors.Is(err, errors.ErrUnsupported) {
+		return newProblem(http.StatusNotImplemented, "not supported by this server")
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return newProblem(http.StatusServiceUnavailable, "request timed out")
+	}
+	if errors.Is(err, context.Canceled) {
+		return newProblem(http.StatusServiceUnavailable, "request canceled")
+	}
+	// Never leak internal error text to clients
+	return &Problem{Type: problemTypeBlank, Title: http.StatusText(http.StatusInternalServerError), Status: http.StatusInternalServerError}
+}
+
+// writeError reports err as application/problem+json
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	p := problemFor(err)
+	if p.Instance == "" {
+		p.Instance = r.URL.Path
+	}
+	if p.Status >= http.StatusInternalServerError {
+		logger.Error("request failed",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Any("err", err),
+		)
+	}
+	writeJSON(w, p.Status, p)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestProblemFor(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"not found", fmt.Errorf("user 1: %w", ErrNotFound), http.StatusNotFound},
+		{"validation", validate(&User{}), http.StatusUnprocessableEntity},
+		{"problem", fmt.Errorf("wrapped: %w", newProblem(http.StatusBadRequest, "bad")), http.StatusBadRequest},
+		{"unknown", fmt.Errorf("disk on fire"), http.StatusInternalServerError},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p := problemFor(tc.err)
+			if p.Status != tc.want {
+				t.Errorf("status = %d, want %d", p.Status, tc.want)
+			}
+			if p.Type == "" || p.Title == "" {
+				t.Errorf("type and title are required: %+v", p)
+			}
+		})
+	}
+}
+
+func TestErrorResponsesUseProblemJSON(t *testing.T) {
+	h := newServer(NewInMemoryUserRepository())
+	tests := []struct {
+		method, target, body string
+		want                 int
+	}{
+		{http.MethodGet, "/api/users/abc", "", http.StatusBadRequest},
+		{http.MethodGet, "/api/users/1", "", http.StatusNotFound},
+		{http.MethodPost, "/api/users", "{", http.StatusBadRequest},
+		{http.MethodGet, "/api/users?limit=0", "", http.StatusBadRequest},
+	}
+	for _, tc := range tests {
+		t.Run(tc.method+" "+tc.target, func(t *testing.T) {
+			rec := doRequest(t, h, tc.method, tc.target, tc.body)
+			if rec.Code != tc.want {
+				t.Errorf("status = %d, want %d", rec.Code, tc.want)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != problemContentType {
+				t.Errorf("Content-Type = %q", ct)
+			}
+			p := decodeBody[Problem](t, rec)
+			if p.Status != tc.want || p.Instance == "" {
+				t.Errorf("problem = %+v", p)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimit is a token bucket: Burst requests at once, refilled at Rate per second
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter keeps one token bucket per client key in memory
+type rateLimiter struct {
+	limit RateLimit
+	now   func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func newRateLimiter(limit RateLimit) *rateLimiter {
+	return &rateLimiter{
+		limit:   limit,
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// refillTime is how long an empty bucket takes to fill up again
+func (l *rateLimiter) refillTime() time.Duration {
+	return time.Duration(float64(l.limit.Burst) / l.limit.Rate * float64(time.Second))
+}
+
+// allow takes a token for key. It returns the tokens left and, when denied,
+// how long until the next token.
+func (l *rateLimiter) allow(key string) (ok bool, remaining int, retryAfter time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, found := l.buckets[key]
+	if !found {
+		b = &bucket{tokens: float64(l.limit.Burst), last: now}
+		l.buckets[key] = b
+	}
+	elapsed := now.Sub(b.last).Seconds()
+	b.tokens = math.Min(float64(l.limit.Burst), b.tokens+elapsed*l.limit.Rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := (1 - b.tokens) / l.limit.Rate
+		return false, 0, time.Duration(wait * float64(time.Second))
+	}
+	b.tokens--
+	return true, int(b.tokens), 0
+}
+
+// sweep evicts buckets idle long enough to have refilled completely, since
+// a fresh bucket is indistinguishable from them; l.mu must be held
+func (l *rateLimiter) sweep(now time.Time) {
+	idle := max(l.refillTime(), time.Minute)
+	if now.Sub(l.lastSweep) < idle {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= idle {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// clientKey identifies the caller: the authenticated user, else the client IP
+func clientKey(r *http.Request) string {
+	if p, ok := principalFrom(r.Context()); ok {
+		return "user:" + strconv.Itoa(p.UserID)
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// rateLimit rejects requests over the limit with 429 and Retry-After, and
+// reports quota using the RateLimit-* header fields
+func rateLimit(l *rateLimiter) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ok, remaining, retryAfter := l.allow(clientKey(r))
+			h := w.Header()
+			h.Set("RateLimit-Limit", strconv.Itoa(l.limit.Burst))
+			h.Set("RateLimit-Remaining", strconv.Itoa(remaining))
+			h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(l.resetAfter(remaining))))
+			if !ok {
+				h.Set("Retry-After", strconv.Itoa(ceilSeconds(retryAfter)))
+				writeError(w, r, newProblem(http.StatusTooManyRequests,
+					"rate limit of %d requests exceeded", l.limit.Burst))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// resetAfter estimates how long until a bucket with remaining tokens is full
+func (l *rateLimiter) resetAfter(remaining int) time.Duration {
+	missing := float64(l.limit.Burst - remaining)
+	return time.Duration(missing / l.limit.Rate * float64(time.Second))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := newRateLimiter(RateLimit{Rate: 1, Burst: 2})
+	l.now = func() time.Time { return now }
+
+	for i := range 2 {
+		if ok, _, _ := l.allow("a"); !ok {
+			t.Fatalf("request %d denied within burst", i)
+		}
+	}
+	ok, _, retry := l.allow("a")
+	if ok || retry != time.Second {
+		t.Fatalf("over burst: ok = %v, retryAfter = %v", ok, retry)
+	}
+	if ok, _, _ := l.allow("b"); !ok {
+		t.Error("keys must not share a bucket")
+	}
+
+	now = now.Add(time.Second)
+	if ok, _, _ := l.allow("a"); !ok {
+		t.Error("bucket did not refill")
+	}
+
+	// Idle, refilled buckets are evicted
+	now = now.Add(2 * time.Minute)
+	l.allow("c")
+	if _, found := l.buckets["a"]; found {
+		t.Error("idle bucket was not evicted")
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	a := newTestAuthenticator(t)
+	h := newServer(NewInMemoryUserRepository(),
+		WithAuthenticator(a),
+		WithDefaultRateLimit(RateLimit{Rate: 0.001, Burst: 2}),
+		WithRateLimit("GET /api/users", RateLimit{Rate: 0.001, Burst: 1}),
+	)
+	alice := bearer(t, a, Principal{UserID: 1})
+	bob := bearer(t, a, Principal{UserID: 2})
+
+	for i := range 2 {
+		rec := doRequest(t, h, http.MethodGet, "/api/users/1", "", "Authorization", alice)
+		if rec.Code == http.StatusTooManyRequests {
+			t.Fatalf("request %d limited within burst", i)
+		}
+		if rec.Header().Get("RateLimit-Limit") != "2" {
+			t.Errorf("RateLimit-Limit = %q", rec.Header().Get("RateLimit-Limit"))
+		}
+	}
+	rec := doRequest(t, h, http.MethodGet, "/api/users/1", "", "Authorization", alice)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want 429", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" || rec.Header().Get("RateLimit-Remaining") != "0" {
+		t.Errorf("429 headers = %v", rec.Header())
+	}
+
+	// Buckets are per principal, not per IP
+	if rec := doRequest(t, h, http.MethodGet, "/api/users/2", "", "Authorization", bob); rec.Code == http.StatusTooManyRequests {
+		t.Error("bob limited by alice's requests")
+	}
+	// Per-route limits override the default
+	if rec := doRequest(t, h, http.MethodGet, "/api/users", "", "Authorization", bob); rec.Header().Get("RateLimit-Limit") != "1" {
+		t.Errorf("route RateLimit-Limit = %q, want 1", rec.Header().Get("RateLimit-Limit"))
+	}
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"modernc.org/sqlite" // pure Go SQLite driver (no cgo, no external server)
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// migrations are applied in order; the index+1 is the schema version
+var migrations = []string{
+	`CREATE TABLE users (
+		id    INTEGER PRIMARY KEY AUTOINCREMENT,
+		name  TEXT NOT NULL,
+		email TEXT NOT NULL
+	)`,
+	`ALTER TABLE users ADD COLUMN version INTEGER NOT NULL DEFAULT 1`,
+	`CREATE UNIQUE INDEX users_email_unique ON users (lower(email))`,
+	`CREATE TABLE outbox (
+		id      INTEGER PRIMARY KEY AUTOINCREMENT,
+		payload TEXT NOT NULL
+	)`,
+	// Audit fields and soft delete
+	`ALTER TABLE users ADD COLUMN created_at TIMESTAMP`,
+	`ALTER TABLE users ADD COLUMN created_by TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE users ADD COLUMN updated_at TIMESTAMP`,
+	`ALTER TABLE users ADD COLUMN updated_by TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE users ADD COLUMN deleted_at TIMESTAMP`,
+	`ALTER TABLE users ADD COLUMN deleted_by TEXT NOT NULL DEFAULT ''`,
+	`UPDATE users SET created_at = strftime('%Y-%m-%dT%H:%M:%fZ', 'now'), updated_at = strftime('%Y-%m-%dT%H:%M:%fZ', 'now')`,
+	`DROP INDEX users_email_unique`,
+	`CREATE UNIQUE INDEX users_email_unique ON users (lower(email)) WHERE deleted_at IS NULL`,
+	`CREATE TABLE user_history (
+		id      INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		payload TEXT NOT NULL
+	)`,
+	`CREATE INDEX user_history_user_id ON user_history (user_id, id)`,
+	// Users created before user_history existed get a synthetic creation
+	// event, dated by the backfilled created_at, so their audit log is not empty
+	`INSERT INTO user_history (user_id, payload)
+	SELECT id, json_object('type', 'user.created', 'user_id', id, 'occurred_at', created_at)
+	FROM users WHERE id NOT IN (SELECT user_id FROM user_history) ORDER BY id`,
+}
+
+// userColumns matches the field order of scanUser
+const userColumns = `id, name, email, version, created_at, created_by, updated_at, updated_by, deleted_at, deleted_by`
+
+// rowScanner is satisfied by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanUser(row rowScanner) (*User, error) {
+	var u User
+	if err := row.Scan(&u.ID, &u.Name, &u.Email, &u.Version,
+		&u.CreatedAt, &u.CreatedBy, &u.UpdatedAt, &u.UpdatedBy, &u.DeletedAt, &u.DeletedBy); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// dbtx is satisfied by both *sql.DB and *sql.Tx
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// SQLUserRepository is a database/sql implementation of UserRepository
+type SQLUserRepository struct {
+	db *sql.DB // nil inside a transaction
+	q  dbtx    // runs the queries: db, or the current *sql.Tx
+}
+
+// OpenSQLite opens a file-backed SQLite database
+func OpenSQLite(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	// SQLite allows a single writer; serialize access through one connection
+	db.SetMaxOpenConns(1)
+	return db, nil
+}
+
+// NewSQLUserRepository migrates the schema and returns a repository
+func NewSQLUserRepository(db *sql.DB) (*SQLUserRepository, error) {
+	if err := migrate(db); err != nil {
+		return nil, err
+	}
+	return &SQLUserRepository{db: db, q: db}, nil
+}
+
+// migrate applies pending migrations, each in its own transaction
+func migrate(db *sql.DB) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+	var current int
+	if err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return fmt.Errorf("read schema version: %w", err)
+	}
+	for i := current; i < len(migrations); i++ {
+		version := i + 1
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("migration %d: %w", version, err)
+		}
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("migration %d: %w", version, err)
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_migrations (version) VALUES (?)`, version); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("migration %d: %w", version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("migration %d: %w", version, err)
+		}
+	}
+	return nil
+}
+
+func (r *SQLUserRepository) FindByID(ctx context.Context, id int) (*User, error) {
+	u, err := scanUser(r.q.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE id = ? AND deleted_at IS NULL`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("user %d: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("find user %d: %w", id, err)
+	}
+	return u, nil
+}
+
+// History reads the events recorded with each write, oldest first
+func (r *SQLUserRepository) History(ctx context.Context, id int) ([]Event, error) {
+	rows, err := r.q.QueryContext(ctx, `SELECT payload FROM user_history WHERE user_id = ? ORDER BY id`, id)
+	if err != nil {
+		return nil, fmt.Errorf("history of user %d: %w", id, err)
+	}
+	defer rows.Close()
+	var events []Event
+	for rows.Next() {
+		var payload []byte
+		var e Event
+		if err := rows.Scan(&payload); err != nil {
+			return nil, fmt.Errorf("history of user %d: %w", id, err)
+		}
+		if err := json.Unmarshal(payload, &e); err != nil {
+			return nil, fmt.Errorf("history of user %d: %w", id, err)
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("history of user %d: %w", id, err)
+	}
+	if len(events) == 0 {
+		return nil, fmt.Errorf("user %d: %w", id, ErrNotFound)
+	}
+	return events, nil
+}
+
+// Writes record their event in the outbox and the user's history in the
+// same transaction; see OutboxRelay
+func (r *SQLUserRepository) Save(ctx context.Context, user *User) error {
+	return r.atomically(ctx, func(tx *SQLUserRepository) error {
+		if err := tx.save(ctx, user); err != nil {
+			return err
+		}
+		return tx.recordEvent(ctx, newEvent(ctx, UserCreated, user.ID, user))
+	})
+}
+
+func (r *SQLUserRepository) Update(ctx context.Context, user *User) error {
+	return r.atomically(ctx, func(tx *SQLUserRepository) error {
+		if err := tx.update(ctx, user); err != nil {
+			return err
+		}
+		return tx.recordEvent(ctx, newEvent(ctx, UserUpdated, user.ID, user))
+	})
+}
+
+// Delete is a soft delete: the row stays, hidden, and its email is freed
+func (r *SQLUserRepository) Delete(ctx context.Context, id int) error {
+	return r.atomically(ctx, func(tx *SQLUserRepository) error {
+		u, err := tx.delete(ctx, id)
+		if err != nil {
+			return err
+		}
+		return tx.recordEvent(ctx, newEvent(ctx, UserDeleted, id, u))
+	})
+}
+
+// Restore undoes a Delete. It fails with ErrConflict if the user is not
+// deleted or its email has been taken since.
+func (r *SQLUserRepository) Restore(ctx context.Context, id int) (*User, error) {
+	var u *User
+	err := r.atomically(ctx, func(tx *SQLUserRepository) error {
+		var err error
+		if u, err = tx.restore(ctx, id); err != nil {
+			return err
+		}
+		return tx.recordEvent(ctx, newEvent(ctx, UserRestored, id, u))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// atomically runs fn in the current transaction, or in a new one
+func (r *SQLUserRepository) atomically(ctx context.Context, fn func(tx *SQLUserRepository) error) error {
+	return r.WithTx(ctx, func(repo UserRepository) error {
+		return fn(repo.(*SQLUserRepository))
+	})
+}
+
+func (r *SQLUserRepository) save(ctx context.Context, user *User) error {
+	now, actor := time.Now().UTC(), actorFrom(ctx)
+	u, err := scanUser(r.q.QueryRowContext(ctx, `INSERT INTO users (name, email, created_at, created_by, updated_at, updated_by)
+		VALUES (?, ?, ?, ?, ?, ?) RETURNING `+userColumns,
+		user.Name, user.Email, now, actor, now, actor))
+	if isUniqueViolation(err) {
+		return fmt.Errorf("save user: email %q: %w", user.Email, ErrConflict)
+	}
+	if err != nil {
+		return fmt.Errorf("save user: %w", err)
+	}
+	*user = *u
+	return nil
+}
+
+// update succeeds only if user.Version matches the stored version
+func (r *SQLUserRepository) update(ctx context.Context, user *User) error {
+	u, err := scanUser(r.q.QueryRowContext(ctx, `UPDATE users
+		SET name = ?, email = ?, version = version + 1, updated_at = ?, updated_by = ?
+		WHERE id = ? AND version = ? AND deleted_at IS NULL RETURNING `+userColumns,
+		user.Name, user.Email, time.Now().UTC(), actorFrom(ctx), user.ID, user.Version))
+	if isUniqueViolation(err) {
+		return fmt.Errorf("update user %d: email %q: %w", user.ID, user.Email, ErrConflict)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		// Distinguish a missing row from a stale version
+		current, err := r.FindByID(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("user %d: have version %d, stored %d: %w", user.ID, user.Version, current.Version, ErrVersionMismatch)
+	}
+	if err != nil {
+		return fmt.Errorf("update user %d: %w", user.ID, err)
+	}
+	*user = *u
+	return nil
+}
+
+func (r *SQLUserRepository) delete(ctx context.Context, id int) (*User, error) {
+	now, actor := time.Now().UTC(), actorFrom(ctx)
+	u, err := scanUser(r.q.QueryRowContext(ctx, `UPDATE users
+		SET version = version + 1, updated_at = ?, updated_by = ?, deleted_at = ?, deleted_by = ?
+		WHERE id = ? AND deleted_at IS NULL RETURNING `+userColumns,
+		now, actor, now, actor, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("user %d: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("delete user %d: %w", id, err)
+	}
+	return u, nil
+}
+
+func (r *SQLUserRepository) restore(ctx context.Context, id int) (*User, error) {
+	u, err := scanUser(r.q.QueryRowContext(ctx, `UPDATE users
+		SET version = version + 1, updated_at = ?, updated_by = ?, deleted_at = NULL, deleted_by = ''
+		WHERE id = ? AND deleted_at IS NOT NULL RETURNING `+userColumns,
+		time.Now().UTC(), actorFrom(ctx), id))
+	if isUniqueViolation(err) {
+		return nil, fmt.Errorf("restore user %d: email is taken: %w", id, ErrConflict)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		var exists bool
+		if err := r.q.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE id = ?)`, id).Scan(&exists); err != nil {
+			return nil, fmt.Errorf("restore user %d: %w", id, err)
+		}
+		if exists {
+			return nil, fmt.Errorf("restore user %d: not deleted: %w", id, ErrConflict)
+		}
+		return nil, fmt.Errorf("user %d: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("restore user %d: %w", id, err)
+	}
+	return u, nil
+}
+
+// isUniqueViolation reports whether err comes from a UNIQUE constraint
+func isUniqueViolation(err error) bool {
+	sqliteErr, ok := errors.AsType[*sqlite.Error](err)
+	return ok && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+}
+
+// sortColumns whitelists the columns List may order by
+var sortColumns = map[string]string{"": "id", "id": "id", "name": "name", "email": "email"}
+
+func (r *SQLUserRepository) List(ctx context.Context, opts ListOptions) (*UserPage, error) {
+	col, ok := sortColumns[opts.Sort.Field]
+	if !ok {
+		return nil, fmt.Errorf("list users: unknown sort field %q", opts.Sort.Field)
+	}
+	dir, op := "ASC", ">"
+	if opts.Sort.Desc {
+		dir, op = "DESC", "<"
+	}
+
+	query := `SELECT ` + userColumns + ` FROM users
+		WHERE instr(lower(name), lower(?)) > 0 AND instr(lower(email), lower(?)) > 0`
+	args := []any{opts.Name, opts.Email}
+	if !opts.IncludeDeleted {
+		query += ` AND deleted_at IS NULL`
+	}
+	if opts.After != nil {
+		if col == "id" {
+			query += fmt.Sprintf(` AND id %s ?`, op)
+			args = append(args, opts.After.ID)
+		} else {
+			query += fmt.Sprintf(` AND (%s, id) %s (?, ?)`, col, op)
+			args = append(args, opts.After.Key, opts.After.ID)
+		}
+	}
+	query += fmt.Sprintf(` ORDER BY %s %s, id %s LIMIT ?`, col, dir, dir)
+	limit := -1 // SQLite: no limit
+	if opts.Limit > 0 {
+		limit = opts.Limit + 1 // one extra row tells us whether a next page exists
+	}
+	args = append(args, limit)
+
+	rows, err := r.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list users: %w", err)
+	}
+	defer rows.Close()
+
+	page := &UserPage{}
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("list users: %w", err)
+		}
+		page.Users = append(page.Users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list users: %w", err)
+	}
+	if opts.Limit > 0 && len(page.Users) > opts.Limit {
+		page.Users = page.Users[:opts.Limit]
+		page.Next = cursorAfter(opts.Sort, page.Users[opts.Limit-1])
+	}
+	return page, nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func newTestSQLRepository(t *testing.T) *SQLUserRepository {
+	t.Helper()
+	db, err := OpenSQLite(filepath.Join(t.TempDir(), "users.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	repo, err := NewSQLUserRepository(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+func TestSQLUserRepository(t *testing.T) {
+	repo := newTestSQLRepository(t)
+
+	u := &User{Name: "Alice", Email: "alice@example.com"}
+	if err := repo.Save(t.Context(), u); err != nil {
+		t.Fatal(err)
+	}
+	if u.ID == 0 {
+		t.Fatal("Save did not assign an ID")
+	}
+
+	got, err := repo.FindByID(t.Context(), u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got != *u {
+		t.Errorf("got %+v, want %+v", got, u)
+	}
+
+	if _, err := repo.FindByID(t.Context(), 999); !errors.Is(err, ErrNotFound) {
+		t.Errorf("FindByID(999) err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestSQLUserRepositoryPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.db")
+
+	db, err := OpenSQLite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := NewSQLUserRepository(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := &User{Name: "Bob", Email: "bob@example.com"}
+	if err := repo.Save(t.Context(), u); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// Reopening runs migrate again, which must be a no-op
+	db, err = OpenSQLite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	repo, err = NewSQLUserRepository(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.FindByID(t.Context(), u.ID); err != nil {
+		t.Errorf("user lost after reopen: %v", err)
+	}
+}
+
+func TestGetUserHandlerSQLNotFound(t *testing.T) {
+	h := newServer(newTestSQLRepository(t))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/users/42", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestMigrationBackfillsHistory(t *testing.T) {
+	db, err := OpenSQLite(filepath.Join(t.TempDir(), "users.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	// A database from before audit fields, with one user in it
+	if _, err := db.Exec(`CREATE TABLE schema_migrations (version INTEGER PRIMARY KEY)`); err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range migrations[:4] {
+		if _, err := db.Exec(m); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec(`INSERT INTO schema_migrations (version) VALUES (?)`, i+1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.Exec(`INSERT INTO users (name, email) VALUES ('Alice', 'alice@example.com')`); err != nil {
+		t.Fatal(err)
+	}
+
+	repo, err := NewSQLUserRepository(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice, err := repo.FindByID(t.Context(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	history, err := repo.History(t.Context(), alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 || history[0].Type != UserCreated || history[0].UserID != alice.ID || !history[0].OccurredAt.Equal(alice.CreatedAt) {
+		t.Errorf("history = %+v, want one user.created at %v", history, alice.CreatedAt)
+	}
+
+	// Users created after the migration are unaffected
+	bob := &User{Name: "Bob", Email: "bob@example.com"}
+	if err := repo.Save(t.Context(), bob); err != nil {
+		t.Fatal(err)
+	}
+	if history, err := repo.History(t.Context(), bob.ID); err != nil || len(history) != 1 {
+		t.Errorf("Bob's history = %+v, %v", history, err)
+	}
+}
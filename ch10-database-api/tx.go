@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+)
+
+// TxRunner is a unit of work over a UserRepository. WithTx commits when fn
+// returns nil and rolls back on error or panic. fn must only use the
+// repository it is given; touching the outer one may deadlock.
+type TxRunner interface {
+	WithTx(ctx context.Context, fn func(repo UserRepository) error) error
+}
+
+// withTx runs fn in a transaction when repo supports one, directly otherwise
+func withTx(ctx context.Context, repo UserRepository, fn func(repo UserRepository) error) error {
+	if tr, ok := repo.(TxRunner); ok {
+		return tr.WithTx(ctx, fn)
+	}
+	return fn(repo)
+}
+
+// WithTx runs fn against a transaction that records changes in its own maps
+// and reads everything else from r. The changes are applied to r on commit,
+// so the cost is proportional to what fn writes, not to the size of r.
+// Readers keep seeing the old state until then; writers wait.
+func (r *InMemoryUserRepository) WithTx(ctx context.Context, fn func(repo UserRepository) error) error {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+
+	// Holding writeMu keeps r unchanged, so tx can read it without r.mu
+	tx := &InMemoryUserRepository{
+		users:   make(map[int]*User),
+		emails:  make(map[string]int),
+		history: make(map[int][]Event),
+		nextID:  r.nextID,
+		parent:  r,
+	}
+	if err := fn(tx); err != nil {
+		return err // rollback: drop the changes
+	}
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	maps.Copy(r.users, tx.users)
+	for email, id := range tx.emails {
+		if id == 0 {
+			r.freeEmail(email)
+		} else {
+			r.emails[email] = id
+		}
+	}
+	for id, h := range tx.history {
+		r.history[id] = append(r.history[id], h...)
+	}
+	r.nextID = tx.nextID
+	return nil
+}
+
+// WithTx runs fn inside a database/sql transaction. Nested calls join the
+// enclosing transaction.
+func (r *SQLUserRepository) WithTx(ctx context.Context, fn func(repo UserRepository) error) error {
+	if r.db == nil {
+		return fn(r)
+	}
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(&SQLUserRepository{q: tx}); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
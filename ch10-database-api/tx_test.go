@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestWithTx(t *testing.T) {
+	repos := map[string]func(t *testing.T) TxRunner{
+		"memory": func(t *testing.T) TxRunner { return NewInMemoryUserRepository() },
+		"sql":    func(t *testing.T) TxRunner { return newTestSQLRepository(t) },
+	}
+	for name, newRepo := range repos {
+		t.Run(name+"/commit", func(t *testing.T) {
+			tr := newRepo(t)
+			zed := &User{Name: "Zed", Email: "zed@example.com"}
+			if err := tr.(UserRepository).Save(t.Context(), zed); err != nil {
+				t.Fatal(err)
+			}
+			var id int
+			err := tr.WithTx(t.Context(), func(repo UserRepository) error {
+				u := &User{Name: "Alice", Email: "alice@example.com"}
+				if err := repo.Save(t.Context(), u); err != nil {
+					return err
+				}
+				id = u.ID
+				u.Name = "Alice B."
+				if err := repo.Update(t.Context(), u); err != nil {
+					return err
+				}
+				// The transaction sees its own writes next to the committed users
+				page, err := repo.List(t.Context(), ListOptions{Limit: 10})
+				if err != nil {
+					return err
+				}
+				if len(page.Users) != 2 || page.Users[0].Name != "Zed" || page.Users[1].Name != "Alice B." {
+					t.Errorf("List in transaction = %+v", page.Users)
+				}
+				return repo.Save(t.Context(), &User{Name: "Zed 2", Email: "ZED@example.com"})
+			})
+			if !errors.Is(err, ErrConflict) {
+				t.Fatalf("err = %v, want ErrConflict for an email taken outside the transaction", err)
+			}
+
+			err = tr.WithTx(t.Context(), func(repo UserRepository) error {
+				u := &User{Name: "Alice", Email: "alice@example.com"}
+				if err := repo.Save(t.Context(), u); err != nil {
+					return err
+				}
+				id = u.ID
+				u.Name = "Alice B."
+				return repo.Update(t.Context(), u)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			repo := tr.(UserRepository)
+			got, err := repo.FindByID(t.Context(), id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Name != "Alice B." || got.Version != 2 {
+				t.Errorf("got %+v after commit", got)
+			}
+			if h, err := repo.History(t.Context(), id); err != nil || len(h) != 2 {
+				t.Errorf("History after commit = %d events, %v; want 2", len(h), err)
+			}
+		})
+
+		t.Run(name+"/rollback", func(t *testing.T) {
+			tr := newRepo(t)
+			repo := tr.(UserRepository)
+			bob := &User{Name: "Bob", Email: "bob@example.com"}
+			if err := repo.Save(t.Context(), bob); err != nil {
+				t.Fatal(err)
+			}
+
+			errAbort := errors.New("abort")
+			var carolID int
+			err := tr.WithTx(t.Context(), func(repo UserRepository) error {
+				carol := &User{Name: "Carol", Email: "carol@example.com"}
+				if err := repo.Save(t.Context(), carol); err != nil {
+					return err
+				}
+				carolID = carol.ID
+				if err := repo.Delete(t.Context(), bob.ID); err != nil {
+					return err
+				}
+				return errAbort
+			})
+			if !errors.Is(err, errAbort) {
+				t.Fatalf("err = %v, want errAbort", err)
+			}
+			if _, err := repo.FindByID(t.Context(), carolID); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Carol after rollback: err = %v, want ErrNotFound", err)
+			}
+			if _, err := repo.FindByID(t.Context(), bob.ID); err != nil {
+				t.Errorf("Bob after rollback: %v", err)
+			}
+			// The email freed by the rolled-back delete is still taken
+			if err := repo.Save(t.Context(), &User{Name: "Bob 2", Email: "bob@example.com"}); !errors.Is(err, ErrConflict) {
+				t.Errorf("Save duplicate email: err = %v, want ErrConflict", err)
+			}
+		})
+
+		t.Run(name+"/panic", func(t *testing.T) {
+			tr := newRepo(t)
+			func() {
+				defer func() { recover() }()
+				tr.WithTx(t.Context(), func(repo UserRepository) error {
+					repo.Save(t.Context(), &User{Name: "Dave", Email: "dave@example.com"})
+					panic("boom")
+				})
+			}()
+			page, err := tr.(UserRepository).List(t.Context(), ListOptions{Limit: 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(page.Users) != 0 {
+				t.Errorf("got %d users after panic, want 0", len(page.Users))
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// FieldError reports a single rule violation on a struct field
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s %s", e.Field, e.Message)
+}
+
+// rule checks a field value; it returns a message on violation, "" otherwise
+type rule func(v reflect.Value, arg string) string
+
+// rules maps `validate` tag names to their checks
+var rules = map[string]rule{
+	"required": func(v reflect.Value, _ string) string {
+		if v.IsZero() || (v.Kind() == reflect.String && strings.TrimSpace(v.String()) == "") {
+			return "is required"
+		}
+		return ""
+	},
+	"email": func(v reflect.Value, _ string) string {
+		s := v.String()
+		if s == "" {
+			return "" // leave empty values to "required"
+		}
+		addr, err := mail.ParseAddress(s)
+		if err != nil || addr.Address != s {
+			return "must be a valid email address"
+		}
+		return ""
+	},
+	"min": func(v reflect.Value, arg string) string {
+		n, _ := strconv.Atoi(arg)
+		if utf8.RuneCountInString(v.String()) < n {
+			return fmt.Sprintf("must be at least %d characters", n)
+		}
+		return ""
+	},
+	"max": func(v reflect.Value, arg string) string {
+		n, _ := strconv.Atoi(arg)
+		if utf8.RuneCountInString(v.String()) > n {
+			return fmt.Sprintf("must be at most %d characters", n)
+		}
+		return ""
+	},
+}
+
+// validate checks the `validate` struct tags of v (a struct or pointer to
+// struct) and aggregates every violation with errors.Join
+func validate(v any) error {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	rt := rv.Type()
+	var errs []error
+	for i := range rt.NumField() {
+		f := rt.Field(i)
+		tag := f.Tag.Get("validate")
+		if tag == "" {
+			continue
+		}
+		for spec := range strings.SplitSeq(tag, ",") {
+			name, arg, _ := strings.Cut(spec, "=")
+			check, ok := rules[name]
+			if !ok {
+				panic(fmt.Sprintf("validate: unknown rule %q on %s.%s", name, rt.Name(), f.Name))
+			}
+			if msg := check(rv.Field(i), arg); msg != "" {
+				errs = append(errs, &FieldError{Field: jsonName(f), Rule: name, Message: msg})
+				break // report one violation per field
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// jsonName returns the JSON key used for a struct field
+func jsonName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return f.Name
+	}
+	return name
+}
+
+// fieldErrors flattens the FieldErrors inside an errors.Join tree
+func fieldErrors(err error) []*FieldError {
+	switch e := err.(type) {
+	case *FieldError:
+		return []*FieldError{e}
+	case interface{ Unwrap() []error }:
+		var out []*FieldError
+		for _, inner := range e.Unwrap() {
+			out = append(out, fieldErrors(inner)...)
+		}
+		return out
+	case interface{ Unwrap() error }:
+		return fieldErrors(e.Unwrap())
+	}
+	return nil
+}
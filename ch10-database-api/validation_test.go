@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		user User
+		want []string // "field:rule"
+	}{
+		{"valid", User{Name: "Alice", Email: "alice@example.com"}, nil},
+		{"empty", User{}, []string{"name:required", "email:required"}},
+		{"blank name", User{Name: "  ", Email: "alice@example.com"}, []string{"name:required"}},
+		{"bad email", User{Name: "Alice", Email: "alice"}, []string{"email:email"}},
+		{"display name", User{Name: "Alice", Email: "Alice <alice@example.com>"}, []string{"email:email"}},
+		{"long name", User{Name: strings.Repeat("a", 101), Email: "a@example.com"}, []string{"name:max"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []string
+			for _, fe := range fieldErrors(validate(&tc.user)) {
+				got = append(got, fe.Field+":"+fe.Rule)
+			}
+			if strings.Join(got, " ") != strings.Join(tc.want, " ") {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCreateUserValidation(t *testing.T) {
+	repo := NewInMemoryUserRepository()
+	h := newServer(repo)
+
+	rec := doRequest(t, h, http.MethodPost, "/api/users", `{"name":"","email":"nope"}`)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusUnprocessableEntity)
+	}
+	p := decodeBody[Problem](t, rec)
+	if p.Type != problemTypeValidation || len(p.Errors) != 2 {
+		t.Errorf("problem = %+v, want name and email errors", p)
+	}
+	if _, err := repo.FindByID(t.Context(), 1); err == nil {
+		t.Error("invalid user was saved")
+	}
+}
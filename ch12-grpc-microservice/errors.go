@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+)
+
+// Domain errors returned by the repository and service
+var (
+	ErrNotFound         = errors.New("not found")
+	ErrAlreadyExists    = errors.New("already exists")
+	ErrConflict         = errors.New("conflict")
+	ErrInvalidArgument  = errors.New("invalid argument")
+	ErrPermissionDenied = errors.New("permission denied")
+)
+
+// errorDomain identifies this service in google.rpc.ErrorInfo
+const errorDomain = "user.v1.UserService"
+
+// FieldViolation is one invalid request field
+type FieldViolation struct {
+	Field       string
+	Description string
+}
+
+// ValidationError lists every invalid field of a request. It matches
+// ErrInvalidArgument and travels as a google.rpc.BadRequest detail.
+type ValidationError struct {
+	Violations []FieldViolation
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		msgs[i] = v.Field + ": " + v.Description
+	}
+	return "invalid argument: " + strings.Join(msgs, "; ")
+}
+
+func (e *ValidationError) Unwrap() error { return ErrInvalidArgument }
+
+// errorCodes maps domain errors to gRPC codes and ErrorInfo reasons, in
+// the order they are checked
+var errorCodes = []struct {
+	err    error
+	code   codes.Code
+	reason string
+}{
+	{ErrInvalidArgument, codes.InvalidArgument, "INVALID_ARGUMENT"},
+	{ErrNotFound, codes.NotFound, "NOT_FOUND"},
+	{ErrAlreadyExists, codes.AlreadyExists, "ALREADY_EXISTS"},
+	{ErrConflict, codes.Aborted, "CONFLICT"},
+	{ErrPermissionDenied, codes.PermissionDenied, "PERMISSION_DENIED"},
+	{context.DeadlineExceeded, codes.DeadlineExceeded, "TIMEOUT"},
+	{context.Canceled, codes.Canceled, "CANCELED"},
+}
+
+// toStatus translates a domain error into a gRPC status with an ErrorInfo
+// detail, plus a BadRequest detail for validation errors. Errors that
+// already carry a status pass through unchanged.
+func toStatus(err error) *status.Status {
+	if st, ok := status.FromError(err); ok {
+		return st
+	}
+	for _, m := range errorCodes {
+		if !errors.Is(err, m.err) {
+			continue
+		}
+		st := status.New(m.code, err.Error())
+		details := []protoadapt.MessageV1{&errdetails.ErrorInfo{Reason: m.reason, Domain: errorDomain}}
+		if ve, ok := errors.AsType[*ValidationError](err); ok {
+			br := &errdetails.BadRequest{}
+			for _, v := range ve.Violations {
+				br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{
+					Field:       v.Field,
+					Description: v.Description,
+				})
+			}
+			details = append(details, br)
+		}
+		if withDetails, derr := st.WithDetails(details...); derr == nil {
+			st = withDetails
+		}
+		return st
+	}
+	// Never leak internal error text to clients
+	logger.Error("internal error", slog.Any("err", err))
+	return status.New(codes.Internal, "internal error")
+}
+
+// fromStatus is the client-side reverse of toStatus: it turns a status
+// error back into an error matching the domain errors, rebuilding
+// ValidationError from BadRequest. status.Code still works on the result.
+func fromStatus(err error) error {
+	st, ok := status.FromError(err)
+	if !ok || st.Code() == codes.OK {
+		return err
+	}
+	var domain error
+	for _, m := range errorCodes {
+		if m.code == st.Code() {
+			domain = m.err
+			break
+		}
+	}
+	if domain == nil {
+		return err
+	}
+	for _, d := range st.Details() {
+		if br, ok := d.(*errdetails.BadRequest); ok {
+			ve := &ValidationError{}
+			for _, v := range br.GetFieldViolations() {
+				ve.Violations = append(ve.Violations, FieldViolation{Field: v.GetField(), Description: v.GetDescription()})
+			}
+			domain = ve
+		}
+	}
+	return &remoteError{st: st, err: domain}
+}
+
+// remoteError is a status error received from a server
+type remoteError struct {
+	st  *status.Status
+	err error
+}
+
+func (e *remoteError) Error() string {
+	return fmt.Sprintf("rpc error: code = %s desc = %s", e.st.Code(), e.st.Message())
+}
+func (e *remoteError) Unwrap() error              { return e.err }
+func (e *remoteError) GRPCStatus() *status.Status { return e.st }
+
+// errorInterceptor translates domain errors returned by unary handlers.
+// Chain it inside loggingInterceptor so the logged code is the final one.
+func errorInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	resp, err := handler(ctx, req)
+	if err != nil {
+		return resp, toStatus(err).Err()
+	}
+	return resp, nil
+}
+
+// streamErrorInterceptor translates domain errors returned by stream handlers
+func streamErrorInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := handler(srv, ss); err != nil {
+		return toStatus(err).Err()
+	}
+	return nil
+}
+
+// clientErrorInterceptor applies fromStatus to unary call errors
+func clientErrorInterceptor(
+	ctx context.Context,
+	method string,
+	req, reply any,
+	cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker,
+	opts ...grpc.CallOption,
+) error {
+	return fromStatus(invoker(ctx, method, req, reply, cc, opts...))
+}
+
+// clientStreamErrorInterceptor applies fromStatus to stream errors
+func clientStreamErrorInterceptor(
+	ctx context.Context,
+	desc *grpc.StreamDesc,
+	cc *grpc.ClientConn,
+	method string,
+	streamer grpc.Streamer,
+	opts ...grpc.CallOption,
+) (grpc.ClientStream, error) {
+	s, err := streamer(ctx, desc, cc, method, opts...)
+	if err != nil {
+		return nil, fromStatus(err)
+	}
+	return &translatingClientStream{s}, nil
+}
+
+type translatingClientStream struct {
+	grpc.ClientStream
+}
+
+func (s *translatingClientStream) SendMsg(m any) error { return fromStatus(s.ClientStream.SendMsg(m)) }
+func (s *translatingClientStream) RecvMsg(m any) error { return fromStatus(s.ClientStream.RecvMsg(m)) }
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/forest6511/go-textbook-advanced/ch12-grpc-microservice/userpb"
+)
+
+// failingRepository fails every FindByID with err
+type failingRepository struct {
+	UserRepository
+	err error
+}
+
+func (r *failingRepository) FindByID(context.Context, int64) (*User, error) {
+	return nil, r.err
+}
+
+func TestErrorTranslation(t *testing.T) {
+	violations := []FieldViolation{{"name", "is required"}, {"email", "must be an email address"}}
+	tests := []struct {
+		name       string
+		err        error
+		code       codes.Code
+		reason     string // "" expects no ErrorInfo
+		violations []FieldViolation
+		domain     error // what the client-side error matches; nil for none
+	}{
+		{"validation", &ValidationError{Violations: violations}, codes.InvalidArgument, "INVALID_ARGUMENT", violations, ErrInvalidArgument},
+		{"invalid argument", fmt.Errorf("%w: id must be positive", ErrInvalidArgument), codes.InvalidArgument, "INVALID_ARGUMENT", nil, ErrInvalidArgument},
+		{"not found", fmt.Errorf("user 1: %w", ErrNotFound), codes.NotFound, "NOT_FOUND", nil, ErrNotFound},
+		{"already exists", fmt.Errorf("email a@example.com: %w", ErrAlreadyExists), codes.AlreadyExists, "ALREADY_EXISTS", nil, ErrAlreadyExists},
+		{"conflict", fmt.Errorf("user 1: %w", ErrConflict), codes.Aborted, "CONFLICT", nil, ErrConflict},
+		{"permission", fmt.Errorf("user 1: %w", ErrPermissionDenied), codes.PermissionDenied, "PERMISSION_DENIED", nil, ErrPermissionDenied},
+		{"timeout", fmt.Errorf("query: %w", context.DeadlineExceeded), codes.DeadlineExceeded, "TIMEOUT", nil, context.DeadlineExceeded},
+		{"canceled", context.Canceled, codes.Canceled, "CANCELED", nil, context.Canceled},
+		{"internal", errors.New("disk on fire"), codes.Internal, "", nil, nil},
+		{"status passes through", status.Error(codes.Unauthenticated, "no token"), codes.Unauthenticated, "", nil, nil},
+	}
+	covered := make(map[error]bool)
+	for _, tt := range tests {
+		covered[tt.domain] = true
+	}
+	for _, m := range errorCodes {
+		if !covered[m.err] {
+			t.Errorf("no case for errorCodes entry %v", m.err)
+		}
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := toStatus(tt.err)
+			if st.Code() != tt.code {
+				t.Errorf("code = %v, want %v", st.Code(), tt.code)
+			}
+			if tt.code == codes.Internal && st.Message() != "internal error" {
+				t.Errorf("internal message leaked: %q", st.Message())
+			}
+			var info *errdetails.ErrorInfo
+			var badRequest *errdetails.BadRequest
+			for _, d := range st.Details() {
+				switch d := d.(type) {
+				case *errdetails.ErrorInfo:
+					info = d
+				case *errdetails.BadRequest:
+					badRequest = d
+				}
+			}
+			if tt.reason == "" {
+				if info != nil {
+					t.Errorf("unexpected ErrorInfo %v", info)
+				}
+			} else if info.GetReason() != tt.reason || info.GetDomain() != errorDomain {
+				t.Errorf("ErrorInfo = %v, want reason %s in %s", info, tt.reason, errorDomain)
+			}
+			var got []FieldViolation
+			for _, v := range badRequest.GetFieldViolations() {
+				got = append(got, FieldViolation{v.GetField(), v.GetDescription()})
+			}
+			if !slices.Equal(got, tt.violations) {
+				t.Errorf("BadRequest violations = %v, want %v", got, tt.violations)
+			}
+
+			// Round trip through errorInterceptor and clientErrorInterceptor
+			_, client := startServer(t, &failingRepository{err: tt.err})
+			_, err := client.GetUser(t.Context(), &userpb.GetUserRequest{Id: 1})
+			if status.Code(err) != tt.code {
+				t.Errorf("client code = %v, want %v", status.Code(err), tt.code)
+			}
+			if tt.domain != nil && !errors.Is(err, tt.domain) {
+				t.Errorf("client error %v does not match %v", err, tt.domain)
+			}
+			ve, ok := errors.AsType[*ValidationError](err)
+			if ok != (tt.violations != nil) || (ok && !slices.Equal(ve.Violations, tt.violations)) {
+				t.Errorf("client ValidationError = %v, %v; want %v", ve, ok, tt.violations)
+			}
+		})
+	}
+}
+
+func TestStreamErrorTranslation(t *testing.T) {
+	_, client := startServer(t, NewInMemoryUserRepository())
+
+	_, err := listUsers(t, client, &userpb.ListUsersRequest{MaxUsers: -1})
+	if status.Code(err) != codes.InvalidArgument || !errors.Is(err, ErrInvalidArgument) {
+		t.Fatalf("err = %v, want InvalidArgument", err)
+	}
+	ve, ok := errors.AsType[*ValidationError](err)
+	if want := []FieldViolation{{"max_users", "must not be negative"}}; !ok || !slices.Equal(ve.Violations, want) {
+		t.Errorf("ValidationError = %v, want %v", ve, want)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// loggingInterceptor is a gRPC unary server interceptor for logging
+func loggingInterceptor(
+	ctx context.Context,
+	req any,
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (any, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	logCall(ctx, "gRPC call", info.FullMethod, start, err)
+	return resp, err
+}
+
+// streamLoggingInterceptor is the streaming counterpart of loggingInterceptor.
+// It also logs when the stream opens and how many messages went each way.
+func streamLoggingInterceptor(
+	srv any,
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	start := time.Now()
+	logger.InfoContext(ss.Context(), "gRPC stream opened", slog.String("method", info.FullMethod))
+	cs := &countingServerStream{ServerStream: ss}
+	err := handler(srv, cs)
+	logCall(ss.Context(), "gRPC stream closed", info.FullMethod, start, err,
+		slog.Int64("sent", cs.sent.Load()),
+		slog.Int64("received", cs.received.Load()),
+	)
+	return err
+}
+
+// clientLoggingInterceptor logs unary calls from the caller's side
+func clientLoggingInterceptor(
+	ctx context.Context,
+	method string,
+	req, reply any,
+	cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker,
+	opts ...grpc.CallOption,
+) error {
+	start := time.Now()
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	logCall(ctx, "gRPC client call", method, start, err, slog.String("target", cc.Target()))
+	return err
+}
+
+// clientStreamLoggingInterceptor logs client streams. A stream counts as
+// closed once a receive fails (io.EOF meaning OK), after its only response
+// arrives for streams where the server does not stream, or when the
+// caller's context is canceled first. A stream the caller abandons without
+// canceling is never logged as closed.
+func clientStreamLoggingInterceptor(
+	ctx context.Context,
+	desc *grpc.StreamDesc,
+	cc *grpc.ClientConn,
+	method string,
+	streamer grpc.Streamer,
+	opts ...grpc.CallOption,
+) (grpc.ClientStream, error) {
+	start := time.Now()
+	logger.InfoContext(ctx, "gRPC client stream opened", slog.String("method", method), slog.String("target", cc.Target()))
+	s, err := streamer(ctx, desc, cc, method, opts...)
+	if err != nil {
+		logCall(ctx, "gRPC client stream closed", method, start, err, slog.String("target", cc.Target()))
+		return nil, err
+	}
+	cs := &countingClientStream{ClientStream: s, serverStreams: desc.ServerStreams}
+	cs.onClose = func(err error) {
+		logCall(ctx, "gRPC client stream closed", method, start, err,
+			slog.String("target", cc.Target()),
+			slog.Int64("sent", cs.sent.Load()),
+			slog.Int64("received", cs.received.Load()),
+		)
+	}
+	// A caller that cancels instead of reading to the end never sees the
+	// final status from RecvMsg
+	cs.stopWatch = context.AfterFunc(ctx, func() {
+		cs.finish(status.FromContextError(ctx.Err()).Err())
+	})
+	return cs, nil
+}
+
+// logCall logs a finished call with its duration and status code, at
+// error level unless the code is OK
+func logCall(ctx context.Context, msg, method string, start time.Time, err error, attrs ...slog.Attr) {
+	code := status.Code(err)
+	level := slog.LevelInfo
+	if code != codes.OK {
+		level = slog.LevelError
+	}
+	attrs = append([]slog.Attr{
+		slog.String("method", method),
+		slog.Duration("duration", time.Since(start)),
+		slog.String("code", code.String()),
+	}, attrs...)
+	if err != nil {
+		attrs = append(attrs, slog.Any("err", err))
+	}
+	logger.LogAttrs(ctx, level, msg, attrs...)
+}
+
+// countingServerStream counts messages passing through a server stream
+type countingServerStream struct {
+	grpc.ServerStream
+	sent, received atomic.Int64
+}
+
+func (s *countingServerStream) SendMsg(m any) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.sent.Add(1)
+	}
+	return err
+}
+
+func (s *countingServerStream) RecvMsg(m any) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.received.Add(1)
+	}
+	return err
+}
+
+// countingClientStream counts messages passing through a client stream and
+// calls onClose once when the stream ends
+type countingClientStream struct {
+	grpc.ClientStream
+	serverStreams  bool
+	sent, received atomic.Int64
+	onClose        func(error)
+	stopWatch      func() bool
+	once           sync.Once
+}
+
+func (s *countingClientStream) finish(err error) {
+	s.once.Do(func() { s.onClose(err) })
+}
+
+// ended finishes a stream whose end RecvMsg observed
+func (s *countingClientStream) ended(err error) {
+	s.stopWatch()
+	s.finish(err)
+}
+
+func (s *countingClientStream) SendMsg(m any) error {
+	err := s.ClientStream.SendMsg(m)
+	if err == nil {
+		s.sent.Add(1)
+	}
+	// A failed send means the stream is broken; RecvMsg reports the status
+	return err
+}
+
+func (s *countingClientStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	switch {
+	case errors.Is(err, io.EOF):
+		s.ended(nil)
+	case err != nil:
+		s.ended(err)
+	default:
+		s.received.Add(1)
+		if !s.serverStreams {
+			s.ended(nil)
+		}
+	}
+	return err
+}
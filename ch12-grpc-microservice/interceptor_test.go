@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/forest6511/go-textbook-advanced/ch12-grpc-microservice/userpb"
+)
+
+// logCapture collects JSON log lines written from any goroutine
+type logCapture struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (c *logCapture) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.buf.Write(p)
+}
+
+// captureLogs redirects logger to a logCapture until the test ends
+func captureLogs(t *testing.T) *logCapture {
+	t.Helper()
+	c := &logCapture{}
+	prev := logger
+	logger = slog.New(slog.NewJSONHandler(c, nil))
+	t.Cleanup(func() { logger = prev })
+	return c
+}
+
+// offset marks the end of what has been logged so far
+func (c *logCapture) offset() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.buf.Len()
+}
+
+// waitFor returns the first entry with msg logged after offset, waiting
+// for interceptors that log after the caller has already seen the result
+func (c *logCapture) waitFor(t *testing.T, offset int, msg string) map[string]any {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		c.mu.Lock()
+		lines := bytes.Split(c.buf.Bytes()[offset:], []byte("\n"))
+		c.mu.Unlock()
+		for _, line := range lines {
+			var entry map[string]any
+			if json.Unmarshal(line, &entry) == nil && entry["msg"] == msg {
+				return entry
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no %q log entry in:\n%s", msg, bytes.Join(lines, []byte("\n")))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestStreamLoggingInterceptors(t *testing.T) {
+	repo := NewInMemoryUserRepository()
+	for _, u := range []*User{{Name: "Alice", Email: "alice@example.com"}, {Name: "Bob", Email: "bob@example.com"}} {
+		if err := repo.Create(t.Context(), u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Capture before starting the server, so the logger is restored only
+	// after the server has stopped
+	logs := captureLogs(t)
+	_, client := startServer(t, repo)
+
+	tests := []struct {
+		name     string
+		req      *userpb.ListUsersRequest
+		cancelAt int // cancel the call after receiving this many users; 0 reads to the end
+		server   map[string]any
+		client   map[string]any
+	}{
+		{
+			name:   "complete",
+			req:    &userpb.ListUsersRequest{},
+			server: map[string]any{"code": "OK", "sent": 2.0, "received": 1.0},
+			client: map[string]any{"code": "OK", "sent": 1.0, "received": 2.0},
+		},
+		{
+			name:   "error",
+			req:    &userpb.ListUsersRequest{MaxUsers: -1},
+			server: map[string]any{"code": "InvalidArgument", "sent": 0.0, "received": 1.0, "level": "ERROR"},
+			client: map[string]any{"code": "InvalidArgument", "sent": 1.0, "received": 0.0, "level": "ERROR"},
+		},
+		{
+			name:     "canceled early",
+			req:      &userpb.ListUsersRequest{},
+			cancelAt: 1,
+			// The server may finish sending before it notices the cancel
+			server: map[string]any{},
+			client: map[string]any{"code": "Canceled", "sent": 1.0, "received": 1.0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := logs.offset()
+			ctx, cancel := context.WithCancel(t.Context())
+			defer cancel()
+
+			stream, err := client.ListUsers(ctx, tt.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for n := 1; ; n++ {
+				if _, err := stream.Recv(); err != nil {
+					break
+				}
+				if n == tt.cancelAt {
+					cancel()
+					break
+				}
+			}
+
+			check := func(msg string, want map[string]any) {
+				entry := logs.waitFor(t, start, msg)
+				if entry["method"] != userpb.UserService_ListUsers_FullMethodName {
+					t.Errorf("%s: method = %v", msg, entry["method"])
+				}
+				if _, ok := entry["duration"].(float64); !ok {
+					t.Errorf("%s: no duration in %v", msg, entry)
+				}
+				for k, v := range want {
+					if entry[k] != v {
+						t.Errorf("%s: %s = %v, want %v", msg, k, entry[k], v)
+					}
+				}
+			}
+			logs.waitFor(t, start, "gRPC client stream opened")
+			logs.waitFor(t, start, "gRPC stream opened")
+			check("gRPC client stream closed", tt.client)
+			check("gRPC stream closed", tt.server)
+		})
+	}
+}
@@ -6,34 +6,13 @@ import (
 	"log/slog"
 	"net"
 	"os"
-
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 var logger = slog.New(slog.NewJSONHandler(os.Stdout, nil))
 
-// loggingInterceptor is a gRPC unary server interceptor for logging
-func loggingInterceptor(
-	ctx context.Context,
-	req any,
-	info *grpc.UnaryServerInfo,
-	handler grpc.UnaryHandler,
-) (any, error) {
-	logger.Info("gRPC call", slog.String("method", info.FullMethod))
-	resp, err := handler(ctx, req)
-	if err != nil {
-		logger.Error("gRPC error", slog.String("method", info.FullMethod), slog.Any("err", err))
-	}
-	return resp, err
-}
-
-// notFoundError demonstrates gRPC status codes
-func notFoundError(resource string, id int64) error {
-	return status.Errorf(codes.NotFound, "%s with id %d not found", resource, id)
-}
-
 func main() {
 	lis, err := net.Listen("tcp", ":50051")
 	if err != nil {
@@ -41,21 +20,29 @@ func main() {
 		os.Exit(1)
 	}
 
-	srv := grpc.NewServer(
-		grpc.UnaryInterceptor(loggingInterceptor),
-	)
+	// GRPC_REFLECTION=1 lets grpcurl explore the server during development
+	srv := newServer(NewInMemoryUserRepository(), WithReflection(os.Getenv("GRPC_REFLECTION") == "1"))
+
+	// Graceful shutdown with signal.NotifyContext
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
 
-	logger.Info("gRPC server starting", slog.String("addr", ":50051"))
+	go func() {
+		logger.Info("gRPC server starting", slog.String("addr", lis.Addr().String()))
+		if err := srv.Serve(lis); err != nil {
+			logger.Error("serve error", slog.Any("err", err))
+			os.Exit(1)
+		}
+	}()
 
-	// Demonstrate status error creation
-	err = notFoundError("user", 42)
-	st, _ := status.FromError(err)
-	logger.Info("demo error",
-		slog.String("code", st.Code().String()),
-		slog.String("message", st.Message()),
-	)
+	<-ctx.Done()
+	logger.Info("shutting down...")
 
-	_ = srv
-	_ = lis
-	fmt.Println("gRPC server configured (not starting in demo mode)")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 25*time.Second)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.Error("in-flight RPCs canceled", slog.Any("err", err))
+	}
+	logger.Info("shutdown complete")
 }
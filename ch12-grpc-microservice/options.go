@@ -0,0 +1,25 @@
+package main
+
+// serverConfig holds the tunables of newServer
+type serverConfig struct {
+	healthCheck bool
+	reflection  bool
+}
+
+// ServerOption configures newServer (Functional Options pattern)
+type ServerOption func(*serverConfig)
+
+// WithHealthCheck toggles the grpc.health.v1.Health service (on by default)
+func WithHealthCheck(enabled bool) ServerOption {
+	return func(c *serverConfig) {
+		c.healthCheck = enabled
+	}
+}
+
+// WithReflection toggles server reflection, which lets tools such as
+// grpcurl list and call services without the .proto files (off by default)
+func WithReflection(enabled bool) ServerOption {
+	return func(c *serverConfig) {
+		c.reflection = enabled
+	}
+}
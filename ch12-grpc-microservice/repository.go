@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// User is the domain model behind userpb.User
+type User struct {
+	ID        int64
+	Name      string
+	Email     string
+	CreatedAt time.Time
+}
+
+// validate checks the fields a client may set
+func (u *User) validate() error {
+	var ve ValidationError
+	if strings.TrimSpace(u.Name) == "" {
+		ve.Violations = append(ve.Violations, FieldViolation{"name", "is required"})
+	} else if len(u.Name) > 100 {
+		ve.Violations = append(ve.Violations, FieldViolation{"name", "must be at most 100 characters"})
+	}
+	if !strings.Contains(u.Email, "@") {
+		ve.Violations = append(ve.Violations, FieldViolation{"email", "must be an email address"})
+	}
+	if len(ve.Violations) > 0 {
+		return &ve
+	}
+	return nil
+}
+
+// UserRepository stores users
+type UserRepository interface {
+	FindByID(ctx context.Context, id int64) (*User, error)
+	// Create assigns u.ID and u.CreatedAt
+	Create(ctx context.Context, u *User) error
+	// List returns users in id order
+	List(ctx context.Context) ([]*User, error)
+}
+
+// InMemoryUserRepository is a UserRepository backed by a map
+type InMemoryUserRepository struct {
+	mu     sync.RWMutex
+	users  map[int64]*User
+	emails map[string]int64
+	nextID int64
+}
+
+func NewInMemoryUserRepository() *InMemoryUserRepository {
+	return &InMemoryUserRepository{
+		users:  make(map[int64]*User),
+		emails: make(map[string]int64),
+		nextID: 1,
+	}
+}
+
+func (r *InMemoryUserRepository) FindByID(ctx context.Context, id int64) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	u, ok := r.users[id]
+	if !ok {
+		return nil, fmt.Errorf("user %d: %w", id, ErrNotFound)
+	}
+	cp := *u
+	return &cp, nil
+}
+
+func (r *InMemoryUserRepository) Create(ctx context.Context, u *User) error {
+	if err := u.validate(); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	email := strings.ToLower(u.Email)
+	if _, taken := r.emails[email]; taken {
+		return fmt.Errorf("email %s: %w", u.Email, ErrAlreadyExists)
+	}
+	u.ID = r.nextID
+	u.CreatedAt = time.Now().UTC()
+	r.nextID++
+	cp := *u
+	r.users[u.ID] = &cp
+	r.emails[email] = u.ID
+	return nil
+}
+
+func (r *InMemoryUserRepository) List(ctx context.Context) ([]*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	users := make([]*User, 0, len(r.users))
+	for id := int64(1); id < r.nextID; id++ {
+		if u, ok := r.users[id]; ok {
+			cp := *u
+			users = append(users, &cp)
+		}
+	}
+	return users, nil
+}
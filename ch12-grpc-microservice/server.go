@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+
+	"github.com/forest6511/go-textbook-advanced/ch12-grpc-microservice/userpb"
+)
+
+// Server is a gRPC server that reports its state through the health service
+type Server struct {
+	*grpc.Server
+	health *healthServer // nil when health checking is disabled
+}
+
+// healthServer is a health.Server whose Watch streams end on Shutdown.
+// health.Server keeps them open until the client leaves, which would hold
+// GracefulStop up until it gives up and cancels every RPC.
+type healthServer struct {
+	*health.Server
+	stopping context.Context
+	stop     context.CancelFunc
+}
+
+func newHealthServer() *healthServer {
+	stopping, stop := context.WithCancel(context.Background())
+	return &healthServer{Server: health.NewServer(), stopping: stopping, stop: stop}
+}
+
+// watchStream overrides the context of a Watch stream
+type watchStream struct {
+	healthpb.Health_WatchServer
+	ctx context.Context
+}
+
+func (s watchStream) Context() context.Context { return s.ctx }
+
+// Watch streams status changes until the client leaves or the server shuts
+// down. In the latter case it ends with the final status and Unavailable.
+func (h *healthServer) Watch(in *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+	defer context.AfterFunc(h.stopping, cancel)()
+
+	err := h.Server.Watch(in, watchStream{stream, ctx})
+	if h.stopping.Err() == nil || stream.Context().Err() != nil {
+		return err
+	}
+	// Watch may have returned before sending NOT_SERVING, so repeat it
+	if resp, err := h.Server.Check(stream.Context(), in); err == nil {
+		_ = stream.Send(resp)
+	}
+	return status.Error(codes.Unavailable, "server is shutting down")
+}
+
+// Shutdown reports NOT_SERVING for every service and ends Watch streams
+func (h *healthServer) Shutdown() {
+	h.Server.Shutdown()
+	h.stop()
+}
+
+// newServer returns a gRPC server with UserService registered on repo
+func newServer(repo UserRepository, opts ...ServerOption) *Server {
+	cfg := serverConfig{healthCheck: true}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	s := &Server{Server: grpc.NewServer(
+		grpc.ChainUnaryInterceptor(loggingInterceptor, errorInterceptor),
+		grpc.ChainStreamInterceptor(streamLoggingInterceptor, streamErrorInterceptor),
+	)}
+	userpb.RegisterUserServiceServer(s.Server, &userService{repo: repo})
+
+	if cfg.healthCheck {
+		s.health = newHealthServer()
+		healthpb.RegisterHealthServer(s.Server, s.health)
+		// "" is the overall server status, checked by clients that name no service
+		s.health.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+		s.health.SetServingStatus(userpb.UserService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	}
+	if cfg.reflection {
+		reflection.Register(s.Server)
+	}
+	return s
+}
+
+// GracefulStop reports NOT_SERVING for every service, so load balancers
+// stop sending traffic, then waits for in-flight RPCs to finish
+func (s *Server) GracefulStop() {
+	s.markNotServing()
+	s.Server.GracefulStop()
+}
+
+// Stop reports NOT_SERVING and cancels in-flight RPCs
+func (s *Server) Stop() {
+	s.markNotServing()
+	s.Server.Stop()
+}
+
+// Shutdown stops the server gracefully, but cancels RPCs still running
+// when ctx is done and then returns ctx.Err()
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.markNotServing()
+	done := make(chan struct{})
+	go func() {
+		s.Server.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.Server.Stop()
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (s *Server) markNotServing() {
+	if s.health != nil {
+		// Shutdown also ignores later SetServingStatus calls and ends Watch
+		// streams, which GracefulStop would otherwise wait for
+		s.health.Shutdown()
+	}
+}
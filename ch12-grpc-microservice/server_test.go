@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/forest6511/go-textbook-advanced/ch12-grpc-microservice/userpb"
+)
+
+// blockingRepository holds FindByID until release is closed
+type blockingRepository struct {
+	UserRepository
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (r *blockingRepository) FindByID(ctx context.Context, id int64) (*User, error) {
+	r.entered <- struct{}{}
+	select {
+	case <-r.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return r.UserRepository.FindByID(ctx, id)
+}
+
+// startServer serves repo over an in-memory listener
+func startServer(t *testing.T, repo UserRepository) (*Server, userpb.UserServiceClient) {
+	t.Helper()
+	srv := newServer(repo)
+	return srv, userpb.NewUserServiceClient(dial(t, srv))
+}
+
+// dial serves srv over an in-memory listener and connects to it
+func dial(t *testing.T, srv *Server) *grpc.ClientConn {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	cc, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithChainUnaryInterceptor(clientLoggingInterceptor, clientErrorInterceptor),
+		grpc.WithChainStreamInterceptor(clientStreamLoggingInterceptor, clientStreamErrorInterceptor),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cc.Close() })
+	return cc
+}
+
+func TestHealthCheck(t *testing.T) {
+	health := healthpb.NewHealthClient(dial(t, newServer(NewInMemoryUserRepository())))
+	for _, service := range []string{"", userpb.UserService_ServiceDesc.ServiceName} {
+		resp, err := health.Check(t.Context(), &healthpb.HealthCheckRequest{Service: service})
+		if err != nil || resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+			t.Errorf("Check(%q) = %v, %v; want SERVING", service, resp, err)
+		}
+	}
+	if _, err := health.Check(t.Context(), &healthpb.HealthCheckRequest{Service: "unknown.Service"}); status.Code(err) != codes.NotFound {
+		t.Errorf("Check(unknown service): err = %v, want NotFound", err)
+	}
+
+	disabled := healthpb.NewHealthClient(dial(t, newServer(NewInMemoryUserRepository(), WithHealthCheck(false))))
+	if _, err := disabled.Check(t.Context(), &healthpb.HealthCheckRequest{}); status.Code(err) != codes.Unimplemented {
+		t.Errorf("WithHealthCheck(false): err = %v, want Unimplemented", err)
+	}
+}
+
+func TestReflection(t *testing.T) {
+	// listServices asks the reflection service which services srv exposes
+	listServices := func(srv *Server) ([]string, error) {
+		stream, err := reflectionpb.NewServerReflectionClient(dial(t, srv)).ServerReflectionInfo(t.Context())
+		if err != nil {
+			return nil, err
+		}
+		req := &reflectionpb.ServerReflectionRequest{MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{}}
+		if err := stream.Send(req); err != nil {
+			return nil, err
+		}
+		resp, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		var names []string
+		for _, s := range resp.GetListServicesResponse().GetService() {
+			names = append(names, s.GetName())
+		}
+		return names, nil
+	}
+
+	names, err := listServices(newServer(NewInMemoryUserRepository(), WithReflection(true)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{userpb.UserService_ServiceDesc.ServiceName, healthpb.Health_ServiceDesc.ServiceName} {
+		if !slices.Contains(names, want) {
+			t.Errorf("reflection lists %v, missing %s", names, want)
+		}
+	}
+
+	if _, err := listServices(newServer(NewInMemoryUserRepository())); status.Code(err) != codes.Unimplemented {
+		t.Errorf("reflection is on by default: err = %v", err)
+	}
+}
+
+func TestShutdownWaitsForInFlightRPCs(t *testing.T) {
+	mem := NewInMemoryUserRepository()
+	if err := mem.Create(t.Context(), &User{Name: "Alice", Email: "alice@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	repo := &blockingRepository{UserRepository: mem, entered: make(chan struct{}), release: make(chan struct{})}
+	srv, client := startServer(t, repo)
+
+	type result struct {
+		resp *userpb.GetUserResponse
+		err  error
+	}
+	call := make(chan result)
+	go func() {
+		resp, err := client.GetUser(t.Context(), &userpb.GetUserRequest{Id: 1})
+		call <- result{resp, err}
+	}()
+	<-repo.entered
+
+	shutdown := make(chan error)
+	go func() { shutdown <- srv.Shutdown(t.Context()) }()
+
+	// Health flips before the in-flight call finishes
+	deadline := time.Now().Add(time.Second)
+	for {
+		resp, err := srv.health.Check(t.Context(), &healthpb.HealthCheckRequest{Service: userpb.UserService_ServiceDesc.ServiceName})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.GetStatus() == healthpb.HealthCheckResponse_NOT_SERVING {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("health status = %v during shutdown", resp.GetStatus())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case err := <-shutdown:
+		t.Fatalf("Shutdown returned %v with an RPC in flight", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(repo.release)
+	if r := <-call; r.err != nil || r.resp.GetUser().GetName() != "Alice" {
+		t.Errorf("in-flight GetUser = %v, %v", r.resp, r.err)
+	}
+	if err := <-shutdown; err != nil {
+		t.Errorf("Shutdown: %v", err)
+	}
+}
+
+func TestShutdownCancelsRPCsPastDeadline(t *testing.T) {
+	repo := &blockingRepository{UserRepository: NewInMemoryUserRepository(), entered: make(chan struct{}), release: make(chan struct{})}
+	srv, client := startServer(t, repo)
+
+	call := make(chan error)
+	go func() {
+		_, err := client.GetUser(t.Context(), &userpb.GetUserRequest{Id: 1})
+		call <- err
+	}()
+	<-repo.entered
+
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+	if err := srv.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown: err = %v, want DeadlineExceeded", err)
+	}
+	if err := <-call; status.Code(err) != codes.Unavailable {
+		t.Errorf("canceled GetUser: err = %v, want Unavailable", err)
+	}
+}
+
+func TestShutdownEndsHealthWatch(t *testing.T) {
+	srv := newServer(NewInMemoryUserRepository())
+	stream, err := healthpb.NewHealthClient(dial(t, srv)).Watch(t.Context(), &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp, err := stream.Recv(); err != nil || resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("first Watch update = %v, %v; want SERVING", resp, err)
+	}
+
+	// An open Watch must not hold up a graceful shutdown
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	var last healthpb.HealthCheckResponse_ServingStatus
+	for {
+		resp, err := stream.Recv()
+		if err != nil {
+			if status.Code(err) != codes.Unavailable {
+				t.Errorf("Watch ended with %v, want Unavailable", err)
+			}
+			break
+		}
+		last = resp.GetStatus()
+	}
+	if last != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("last Watch update = %v, want NOT_SERVING", last)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/forest6511/go-textbook-advanced/ch12-grpc-microservice/userpb"
+)
+
+// userService implements userpb.UserServiceServer on top of a UserRepository
+type userService struct {
+	userpb.UnimplementedUserServiceServer
+	repo UserRepository
+}
+
+func (s *userService) GetUser(ctx context.Context, req *userpb.GetUserRequest) (*userpb.GetUserResponse, error) {
+	u, err := s.repo.FindByID(ctx, req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	return &userpb.GetUserResponse{User: toProto(u)}, nil
+}
+
+func (s *userService) CreateUser(ctx context.Context, req *userpb.CreateUserRequest) (*userpb.CreateUserResponse, error) {
+	u := &User{Name: req.GetName(), Email: req.GetEmail()}
+	if err := s.repo.Create(ctx, u); err != nil {
+		return nil, err
+	}
+	return &userpb.CreateUserResponse{User: toProto(u)}, nil
+}
+
+func (s *userService) ListUsers(req *userpb.ListUsersRequest, stream grpc.ServerStreamingServer[userpb.User]) error {
+	if req.GetMaxUsers() < 0 {
+		return &ValidationError{Violations: []FieldViolation{{"max_users", "must not be negative"}}}
+	}
+	users, err := s.repo.List(stream.Context())
+	if err != nil {
+		return err
+	}
+	if n := int(req.GetMaxUsers()); n > 0 && n < len(users) {
+		users = users[:n]
+	}
+	for _, u := range users {
+		if err := stream.Send(toProto(u)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func toProto(u *User) *userpb.User {
+	return &userpb.User{
+		Id:         u.ID,
+		Name:       u.Name,
+		Email:      u.Email,
+		CreateTime: timestamppb.New(u.CreatedAt),
+	}
+}
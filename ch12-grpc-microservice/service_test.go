@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"slices"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/forest6511/go-textbook-advanced/ch12-grpc-microservice/userpb"
+)
+
+// listUsers drains a ListUsers stream
+func listUsers(t *testing.T, client userpb.UserServiceClient, req *userpb.ListUsersRequest) ([]*userpb.User, error) {
+	t.Helper()
+	stream, err := client.ListUsers(t.Context(), req)
+	if err != nil {
+		return nil, err
+	}
+	var users []*userpb.User
+	for {
+		u, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return users, nil
+		}
+		if err != nil {
+			return users, err
+		}
+		users = append(users, u)
+	}
+}
+
+func TestUserService(t *testing.T) {
+	_, client := startServer(t, NewInMemoryUserRepository())
+	ctx := t.Context()
+
+	created, err := client.CreateUser(ctx, &userpb.CreateUserRequest{Name: "Alice", Email: "alice@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := created.GetUser()
+	if alice.GetId() != 1 || alice.GetName() != "Alice" || !alice.GetCreateTime().IsValid() || alice.GetCreateTime().AsTime().IsZero() {
+		t.Errorf("created = %v", alice)
+	}
+	if _, err := client.CreateUser(ctx, &userpb.CreateUserRequest{Name: "Bob", Email: "bob@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.CreateUser(ctx, &userpb.CreateUserRequest{Name: "Imposter", Email: "ALICE@example.com"}); status.Code(err) != codes.AlreadyExists {
+		t.Errorf("duplicate email: err = %v, want AlreadyExists", err)
+	}
+
+	got, err := client.GetUser(ctx, &userpb.GetUserRequest{Id: alice.GetId()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.GetUser().GetEmail() != "alice@example.com" || !got.GetUser().GetCreateTime().AsTime().Equal(alice.GetCreateTime().AsTime()) {
+		t.Errorf("GetUser = %v", got.GetUser())
+	}
+	if _, err := client.GetUser(ctx, &userpb.GetUserRequest{Id: 999}); status.Code(err) != codes.NotFound {
+		t.Errorf("missing user: err = %v, want NotFound", err)
+	}
+
+	tests := []struct {
+		maxUsers int32
+		want     []string
+	}{
+		{0, []string{"Alice", "Bob"}},
+		{1, []string{"Alice"}},
+		{5, []string{"Alice", "Bob"}},
+	}
+	for _, tt := range tests {
+		users, err := listUsers(t, client, &userpb.ListUsersRequest{MaxUsers: tt.maxUsers})
+		if err != nil {
+			t.Fatalf("ListUsers(max_users=%d): %v", tt.maxUsers, err)
+		}
+		var names []string
+		for _, u := range users {
+			names = append(names, u.GetName())
+		}
+		if !slices.Equal(names, tt.want) {
+			t.Errorf("ListUsers(max_users=%d) = %v, want %v", tt.maxUsers, names, tt.want)
+		}
+	}
+}
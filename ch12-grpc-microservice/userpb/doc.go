@@ -0,0 +1,4 @@
+// Package userpb holds the generated protobuf and gRPC code for user.proto.
+package userpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative user.proto